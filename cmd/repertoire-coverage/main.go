@@ -0,0 +1,185 @@
+// repertoire-coverage reports how well the given fonts cover a repertoire:
+// which of the repertoire's code points each font's cmap covers, which are
+// missing and which cmap entries fall outside the repertoire.
+//
+// $ repertoire-coverage -repertoire=wgl4,pinyin Go-Regular.ttf
+//
+// Each of the -repertoire flag's comma-separated repertoires is either a name
+// that the github.com/nigeltao/fontscripts/repertoire package knows, such as
+// "wgl4" or "latin1", or the filename of a repertoire file, with one code
+// point (such as "1EA0") or range (such as "1EA0..1EF9") per line.
+//
+// The fonts can be TrueType (.ttf) or OpenType (.otf) fonts, WOFF (.woff) or
+// WOFF2 (.woff2) web fonts, or individual fonts of a TrueType or OpenType
+// collection (.ttc or .otc), selected by an index suffix such as
+// "NotoSansCJK.ttc#2".
+//
+// The exit status is 1 if any font is missing any of the repertoire.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/nigeltao/fontscripts/fontfile"
+	"github.com/nigeltao/fontscripts/repertoire"
+
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/text/unicode/runenames"
+)
+
+var (
+	formatFlag     = flag.String("format", "text", `output format: "text" or "json"`)
+	repertoireFlag = flag.String("repertoire", "go-fonts", "comma-separated names or filenames of repertoires to union: "+
+		strings.Join(repertoire.Names(), ", "))
+)
+
+type report struct {
+	Font    string   `json:"font"`
+	Name    string   `json:"name"`
+	Total   int      `json:"total"`
+	Covered []string `json:"covered"`
+	Missing []string `json:"missing"`
+	Outside []string `json:"outside"`
+
+	covered repertoire.Set
+	missing repertoire.Set
+	outside repertoire.Set
+}
+
+func main() {
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s -repertoire=name filename1.ttf filename2.ttf etc\n", os.Args[0])
+		os.Exit(1)
+	}
+	if *formatFlag != "text" && *formatFlag != "json" {
+		fmt.Fprintf(os.Stderr, "%s: unknown -format %q\n", os.Args[0], *formatFlag)
+		os.Exit(1)
+	}
+
+	rep := repertoire.Set(nil)
+	for _, name := range strings.Split(*repertoireFlag, ",") {
+		s, err := repertoire.Load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+			os.Exit(1)
+		}
+		rep = rep.Union(s)
+	}
+
+	complete := true
+	reports := make([]*report, len(args))
+	for i, arg := range args {
+		reports[i] = check(arg, rep)
+		complete = complete && len(reports[i].missing) == 0
+	}
+
+	if *formatFlag == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(reports); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		for _, r := range reports {
+			r.print()
+		}
+	}
+
+	if !complete {
+		os.Exit(1)
+	}
+}
+
+func check(filename string, rep repertoire.Set) *report {
+	fontBytes, err := fontfile.Load(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := sfnt.Parse(fontBytes)
+	if err != nil {
+		log.Fatalf("%s: %v", filename, err)
+	}
+
+	var buf sfnt.Buffer
+	cmap := repertoire.Set(nil)
+	for r := rune(0); r <= unicode.MaxRune; r++ {
+		x, err := f.GlyphIndex(&buf, r)
+		if err != nil {
+			log.Fatalf("%s: %v", filename, err)
+		}
+		if x != 0 {
+			cmap = append(cmap, r)
+		}
+	}
+
+	name, err := f.Name(&buf, sfnt.NameIDFull)
+	if err != nil {
+		name = ""
+	}
+	r := &report{
+		Font:    filename,
+		Name:    name,
+		Total:   len(rep),
+		covered: rep.Intersection(cmap),
+		missing: rep.Difference(cmap),
+		outside: cmap.Difference(rep),
+	}
+	r.Covered = codePoints(r.covered)
+	r.Missing = codePoints(r.missing)
+	r.Outside = codePoints(r.outside)
+	return r
+}
+
+func (r *report) print() {
+	fmt.Printf("%s: %s\n", r.Font, r.Name)
+	fmt.Printf("covered %d of %d:", len(r.covered), r.Total)
+	for _, s := range ranges(r.covered) {
+		fmt.Printf(" %s", s)
+	}
+	fmt.Println()
+	fmt.Printf("missing %d:\n", len(r.missing))
+	for _, c := range r.missing {
+		fmt.Printf("\tU+%04X %s\n", c, runenames.Name(c))
+	}
+	fmt.Printf("outside %d:\n", len(r.outside))
+	for _, c := range r.outside {
+		fmt.Printf("\tU+%04X %s\n", c, runenames.Name(c))
+	}
+	fmt.Println()
+}
+
+// codePoints formats s as a list like ["U+0041", "U+0042"]. It never returns
+// nil, so that empty lists are "[]", not "null", in JSON.
+func codePoints(s repertoire.Set) []string {
+	ret := make([]string, len(s))
+	for i, c := range s {
+		ret[i] = fmt.Sprintf("U+%04X", c)
+	}
+	return ret
+}
+
+// ranges formats s compactly as a list like ["0041..005A", "00C0"].
+func ranges(s repertoire.Set) []string {
+	ret := []string(nil)
+	for i := 0; i < len(s); {
+		j := i + 1
+		for j < len(s) && s[j] == s[j-1]+1 {
+			j++
+		}
+		if j-i == 1 {
+			ret = append(ret, fmt.Sprintf("%04X", s[i]))
+		} else {
+			ret = append(ret, fmt.Sprintf("%04X..%04X", s[i], s[j-1]))
+		}
+		i = j
+	}
+	return ret
+}
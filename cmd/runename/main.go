@@ -4,30 +4,579 @@
 // U+0000005C REVERSE SOLIDUS
 // U+00002603 SNOWMAN
 // U+0001F574 MAN IN BUSINESS SUIT LEVITATING
+//
+// With the -lookup flag, the arguments are names instead of code points, and
+// every matching code point is printed. Matching is case-insensitive. The
+// "exact" mode matches the whole name, "prefix" matches the start of the name
+// and "fuzzy" matches names that contain every word of the argument, in any
+// order.
+//
+// $ runename -lookup=fuzzy "greek question"
+// U+0000037E GREEK QUESTION MARK
+//
+// Code point arguments can also be inclusive ranges, such as 2070..209F, and
+// can be written as U+2603, 0x2603, uni2603 or u2603 as well as plain hex. With
+// the -s flag, the arguments are literal strings instead, and every rune in
+// them is printed. With no arguments, code points (or, with -s, text) are read
+// from stdin, one or more per line. Anything after a '#' on a code point line
+// is a comment.
+//
+// $ runename -s "Ǎ;"
+// U+000001CD LATIN CAPITAL LETTER A WITH CARON
+// U+0000003B SEMICOLON
+//
+// The -format flag selects "json", "csv" or "tsv" output instead of the
+// default "text". These formats also report each code point's general
+// category, script, block, bidi class, canonical and compatibility
+// decompositions and simple case mappings.
+//
+// Names, properties and blocks all come from the one Unicode version of the
+// golang.org/x/text tables (runenames.UnicodeVersion). Code points assigned
+// only in later versions are reported as unassigned, even if the standard
+// library's unicode package is newer.
+//
+// Each -font flag, which can be repeated, adds a column that shows that font's
+// glyph ID and glyph name for each code point, or "missing". Fonts can be TTF,
+// OTF, WOFF or WOFF2 files, or one font of a TTC or OTC collection, such as
+// "NotoSansCJK.ttc#2".
+//
+// $ runename -font Go-Regular.ttf -font Go-Mono.ttf 41 2603
+// U+00000041 LATIN CAPITAL LETTER A	36 A	36 A
+// U+00002603 SNOWMAN	missing	missing
+//
+// Problematic input is flagged with a "!" and a status: invalid-hex,
+// out-of-range (above U+10FFFF), invalid-range (such as 2..1), invalid-utf8
+// (for -s), surrogate, noncharacter, private-use or unassigned. The exit
+// status is 1 if any input was flagged with anything other than private-use.
+//
+// $ runename zz d800 e000
+// !invalid-hex parsing "zz": invalid syntax
+// U+0000D800 <Non Private Use High Surrogate> !surrogate
+// U+0000E000 <Private Use> !private-use
 package main
 
 import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nigeltao/fontscripts/fontfile"
+	"github.com/nigeltao/fontscripts/repertoire"
 
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/text/unicode/bidi"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/unicode/rangetable"
 	"golang.org/x/text/unicode/runenames"
 )
 
+var (
+	lookupFlag = flag.String("lookup", "", `match names instead of code points: "exact", "prefix" or "fuzzy"`)
+	sFlag      = flag.Bool("s", false, "treat the arguments as literal strings instead of code points")
+	formatFlag = flag.String("format", "text", `output format: "text", "json", "csv" or "tsv"`)
+	fontFlag   stringsFlag
+)
+
+func init() {
+	flag.Var(&fontFlag, "font", "font `filename` to look up glyphs in; can be repeated")
+}
+
+// stringsFlag is a flag.Value that accumulates every occurrence of the flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
 func main() {
-	for _, a := range os.Args[1:] {
-		if strings.HasPrefix(a, "U+") || strings.HasPrefix(a, "u+") {
-			a = a[2:]
+	flag.Parse()
+	args := flag.Args()
+
+	for _, arg := range fontFlag {
+		fontBytes, err := fontfile.Load(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+			os.Exit(1)
+		}
+		f, err := sfnt.Parse(fontBytes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s: %v\n", os.Args[0], arg, err)
+			os.Exit(1)
+		}
+		fonts = append(fonts, f)
+	}
+
+	switch *formatFlag {
+	case "text", "json":
+	case "csv", "tsv":
+		csvWriter = csv.NewWriter(os.Stdout)
+		if *formatFlag == "tsv" {
+			csvWriter.Comma = '\t'
+		}
+		header := csvHeader
+		for _, arg := range fontFlag {
+			base := filepath.Base(arg)
+			header = append(header, base+" glyphID", base+" glyphName")
+		}
+		csvWriter.Write(header)
+	default:
+		fmt.Fprintf(os.Stderr, "%s: unknown -format %q\n", os.Args[0], *formatFlag)
+		os.Exit(1)
+	}
+
+	if *lookupFlag != "" {
+		match := matchers[*lookupFlag]
+		if match == nil {
+			fmt.Fprintf(os.Stderr, "%s: unknown -lookup mode %q\n", os.Args[0], *lookupFlag)
+			os.Exit(1)
+		}
+		for _, a := range args {
+			lookup(normalize(a), match)
+		}
+	} else if len(args) > 0 {
+		for _, a := range args {
+			do(a)
+		}
+	} else {
+		readStdin()
+	}
+
+	flush()
+	if badInput {
+		os.Exit(1)
+	}
+}
+
+// readStdin calls do for every code point, range or (with -s) line of text
+// read from stdin.
+func readStdin() {
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() {
+		line := s.Text()
+		if *sFlag {
+			do(line)
+			continue
+		}
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		for _, a := range strings.Fields(line) {
+			do(a)
+		}
+	}
+	if err := s.Err(); err != nil {
+		flush()
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+		os.Exit(1)
+	}
+}
+
+// do prints the names for a single argument: every rune of a literal string
+// if the -s flag is set, otherwise a code point or range of code points.
+func do(a string) {
+	if *sFlag {
+		for i, r := range a {
+			if r == utf8.RuneError {
+				if _, size := utf8.DecodeRuneInString(a[i:]); size <= 1 {
+					emit(&record{
+						Status: "invalid-utf8",
+						Error:  fmt.Sprintf("invalid UTF-8 at byte offset %d of %q", i, a),
+					})
+					continue
+				}
+			}
+			emit(newRecord(r))
+		}
+		return
+	}
+
+	lo, hi, err := repertoire.ParseRange(a)
+	if err != nil {
+		status := "invalid-hex"
+		if errors.Is(err, repertoire.ErrOutOfRange) {
+			status = "out-of-range"
+		} else if errors.Is(err, repertoire.ErrInvalidRange) {
+			status = "invalid-range"
+		}
+		emit(&record{Status: status, Error: err.Error()})
+		return
+	}
+	for r := lo; r <= hi; r++ {
+		emit(newRecord(r))
+	}
+}
+
+// matchers are the -lookup modes. Both the query and the name are in
+// normalized form.
+var matchers = map[string]func(query string, name string) bool{
+	"exact": func(query string, name string) bool {
+		return name == query
+	},
+	"prefix": func(query string, name string) bool {
+		return strings.HasPrefix(name, query)
+	},
+	"fuzzy": func(query string, name string) bool {
+		for _, word := range strings.Fields(query) {
+			if !strings.Contains(name, word) {
+				return false
+			}
+		}
+		return true
+	},
+}
+
+// lookup prints every code point whose name matches the query.
+func lookup(query string, match func(query string, name string) bool) {
+	if query == "" {
+		return
+	}
+	for r := rune(0); r <= unicode.MaxRune; r++ {
+		name := runenames.Name(r)
+		// Skip the unnamed and range-named code points, such as "<control>"
+		// or "<CJK Ideograph>".
+		if name == "" || name[0] == '<' {
+			continue
+		}
+		if match(query, name) {
+			emit(newRecord(r))
+		}
+	}
+}
+
+// normalize upper-cases s, treats underscores as spaces and collapses runs of
+// white space to single spaces, so that "snow_man" and "SNOW  MAN" are
+// equivalent.
+func normalize(s string) string {
+	s = strings.ToUpper(s)
+	s = strings.ReplaceAll(s, "_", " ")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// record holds the properties of a single code point. A record with a
+// non-empty Error is for input that couldn't be parsed. A non-empty Status
+// flags a problem with the input, as listed in the package documentation.
+type record struct {
+	r rune
+
+	CodePoint                  string `json:"codePoint"`
+	Name                       string `json:"name"`
+	GeneralCategory            string `json:"generalCategory"`
+	Script                     string `json:"script"`
+	Block                      string `json:"block"`
+	BidiClass                  string `json:"bidiClass"`
+	CanonicalDecomposition     string `json:"canonicalDecomposition,omitempty"`
+	CompatibilityDecomposition string `json:"compatibilityDecomposition,omitempty"`
+	Uppercase                  string `json:"uppercase,omitempty"`
+	Lowercase                  string `json:"lowercase,omitempty"`
+	Titlecase                  string `json:"titlecase,omitempty"`
+	Status                     string `json:"status,omitempty"`
+	Error                      string `json:"error,omitempty"`
+
+	Fonts []fontGlyph `json:"fonts,omitempty"`
+}
+
+// fontGlyph is the glyph, if any, that a -font maps a code point to.
+type fontGlyph struct {
+	Font      string `json:"font"`
+	GlyphID   int    `json:"glyphID,omitempty"`
+	GlyphName string `json:"glyphName"`
+}
+
+func (g fontGlyph) String() string {
+	if g.GlyphID == 0 {
+		return g.GlyphName
+	}
+	return fmt.Sprintf("%d %s", g.GlyphID, g.GlyphName)
+}
+
+var csvHeader = []string{
+	"codePoint",
+	"name",
+	"generalCategory",
+	"script",
+	"block",
+	"bidiClass",
+	"canonicalDecomposition",
+	"compatibilityDecomposition",
+	"uppercase",
+	"lowercase",
+	"titlecase",
+	"status",
+	"error",
+}
+
+func (rec *record) csvRow() []string {
+	row := []string{
+		rec.CodePoint,
+		rec.Name,
+		rec.GeneralCategory,
+		rec.Script,
+		rec.Block,
+		rec.BidiClass,
+		rec.CanonicalDecomposition,
+		rec.CompatibilityDecomposition,
+		rec.Uppercase,
+		rec.Lowercase,
+		rec.Titlecase,
+		rec.Status,
+		rec.Error,
+	}
+	for _, g := range rec.Fonts {
+		glyphID := ""
+		if g.GlyphID != 0 {
+			glyphID = strconv.Itoa(g.GlyphID)
 		}
-		name := ""
-		n, err := strconv.ParseInt(a, 16, 64)
+		row = append(row, glyphID, g.GlyphName)
+	}
+	return row
+}
+
+func newRecord(r rune) *record {
+	rec := &record{
+		r:               r,
+		CodePoint:       fmt.Sprintf("U+%04X", r),
+		Name:            runenames.Name(r),
+		GeneralCategory: generalCategory(r),
+		Script:          script(r),
+		Block:           repertoire.Block(r),
+		Status:          status(r),
+		Fonts:           fontGlyphs(r),
+	}
+	if !utf8.ValidRune(r) {
+		// Surrogates and out-of-range values have no UTF-8 encoding, so
+		// there's nothing to decompose or case map.
+		return rec
+	}
+
+	s := string(r)
+	if p, _ := bidi.LookupRune(r); p.Class() < bidi.Class(len(bidiClassNames)) {
+		rec.BidiClass = bidiClassNames[p.Class()]
+	}
+	nfd := norm.NFD.String(s)
+	if nfd != s {
+		rec.CanonicalDecomposition = codePoints(nfd)
+	}
+	if nfkd := norm.NFKD.String(s); nfkd != nfd {
+		rec.CompatibilityDecomposition = codePoints(nfkd)
+	}
+	if !unicode.Is(assigned, r) {
+		return rec
+	}
+	if u := unicode.ToUpper(r); u != r {
+		rec.Uppercase = codePoints(string(u))
+	}
+	if l := unicode.ToLower(r); l != r {
+		rec.Lowercase = codePoints(string(l))
+	}
+	if t := unicode.ToTitle(r); t != r {
+		rec.Titlecase = codePoints(string(t))
+	}
+	return rec
+}
+
+// status classifies r as a surrogate, noncharacter, private use or
+// unassigned code point, or returns "" if r is none of those.
+func status(r rune) string {
+	switch {
+	case unicode.Is(unicode.Cs, r):
+		return "surrogate"
+	case unicode.Is(unicode.Noncharacter_Code_Point, r):
+		return "noncharacter"
+	case unicode.Is(unicode.Co, r):
+		return "private-use"
+	case generalCategory(r) == "Cn":
+		return "unassigned"
+	}
+	return ""
+}
+
+var (
+	fonts   []*sfnt.Font
+	sfntBuf sfnt.Buffer
+)
+
+// fontGlyphs looks up r in each -font.
+func fontGlyphs(r rune) []fontGlyph {
+	if len(fonts) == 0 {
+		return nil
+	}
+	glyphs := make([]fontGlyph, len(fonts))
+	for i, f := range fonts {
+		g := &glyphs[i]
+		g.Font = filepath.Base(fontFlag[i])
+		x, err := f.GlyphIndex(&sfntBuf, r)
 		if err != nil {
-			name = "!" + err.Error()
+			g.GlyphName = "!" + err.Error()
+			continue
+		} else if x == 0 {
+			g.GlyphName = "missing"
+			continue
+		}
+		g.GlyphID = int(x)
+		// Fonts with a version 3.0 post table have no glyph names.
+		if name, err := f.GlyphName(&sfntBuf, x); err == nil {
+			g.GlyphName = name
+		}
+	}
+	return glyphs
+}
+
+// codePoints formats s as a space-separated list like "U+0041 U+030C".
+func codePoints(s string) string {
+	b := &strings.Builder{}
+	for i, r := range s {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(b, "U+%04X", r)
+	}
+	return b.String()
+}
+
+var (
+	csvWriter   *csv.Writer
+	jsonRecords []*record
+
+	// badInput is whether any record had a Status other than private-use.
+	badInput bool
+)
+
+// emit writes rec in the -format output format. The JSON output is a single
+// array, so it is buffered until flush is called.
+func emit(rec *record) {
+	if rec.Status != "" && rec.Status != "private-use" {
+		badInput = true
+	}
+
+	switch *formatFlag {
+	case "text":
+		if rec.Error != "" {
+			fmt.Printf("!%s %s\n", rec.Status, rec.Error)
 		} else {
-			name = runenames.Name(rune(n))
+			b := &strings.Builder{}
+			fmt.Fprintf(b, "U+%08X %s", rec.r, rec.Name)
+			if rec.Status != "" {
+				b.WriteString(" !")
+				b.WriteString(rec.Status)
+			}
+			for _, g := range rec.Fonts {
+				b.WriteByte('\t')
+				b.WriteString(g.String())
+			}
+			fmt.Println(b.String())
 		}
+	case "json":
+		jsonRecords = append(jsonRecords, rec)
+	case "csv", "tsv":
+		csvWriter.Write(rec.csvRow())
+	}
+}
 
-		fmt.Printf("U+%08X %s\n", n, name)
+func flush() {
+	switch *formatFlag {
+	case "json":
+		if jsonRecords == nil {
+			jsonRecords = []*record{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(jsonRecords); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+			os.Exit(1)
+		}
+		jsonRecords = nil
+	case "csv", "tsv":
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+			os.Exit(1)
+		}
 	}
 }
+
+// assigned is the code points assigned in runenames.UnicodeVersion. The
+// standard library's category, script and case tables can be of a later
+// Unicode version, so they are only consulted for these code points.
+var assigned = rangetable.Assigned(runenames.UnicodeVersion)
+
+var (
+	categoryNames = sortedKeys(unicode.Categories)
+	scriptNames   = sortedKeys(unicode.Scripts)
+)
+
+func sortedKeys(m map[string]*unicode.RangeTable) []string {
+	keys := []string(nil)
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// generalCategory returns the two-letter general category, such as "Lu", of
+// r. Code points in no category are "Cn" (unassigned). The "LC" (cased
+// letter) grouping is skipped in favor of "Lu", "Ll" or "Lt".
+func generalCategory(r rune) string {
+	if !unicode.Is(assigned, r) {
+		return "Cn"
+	}
+	for _, k := range categoryNames {
+		if len(k) == 2 && k != "LC" && unicode.Is(unicode.Categories[k], r) {
+			return k
+		}
+	}
+	return "Cn"
+}
+
+func script(r rune) string {
+	if !unicode.Is(assigned, r) {
+		return "Unknown"
+	}
+	for _, k := range scriptNames {
+		if unicode.Is(unicode.Scripts[k], r) {
+			return k
+		}
+	}
+	return "Unknown"
+}
+
+// bidiClassNames are indexed by bidi.Class.
+var bidiClassNames = [...]string{
+	bidi.L:       "L",
+	bidi.R:       "R",
+	bidi.EN:      "EN",
+	bidi.ES:      "ES",
+	bidi.ET:      "ET",
+	bidi.AN:      "AN",
+	bidi.CS:      "CS",
+	bidi.B:       "B",
+	bidi.S:       "S",
+	bidi.WS:      "WS",
+	bidi.ON:      "ON",
+	bidi.BN:      "BN",
+	bidi.NSM:     "NSM",
+	bidi.AL:      "AL",
+	bidi.Control: "Control",
+	bidi.LRO:     "LRO",
+	bidi.RLO:     "RLO",
+	bidi.LRE:     "LRE",
+	bidi.RLE:     "RLE",
+	bidi.PDF:     "PDF",
+	bidi.LRI:     "LRI",
+	bidi.RLI:     "RLI",
+	bidi.FSI:     "FSI",
+	bidi.PDI:     "PDI",
+}
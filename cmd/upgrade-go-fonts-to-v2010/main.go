@@ -10,6 +10,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/nigeltao/fontscripts/repertoire"
 )
 
 var filenames = []string{
@@ -135,52 +137,9 @@ func do(filename string) {
 			writeMap(w, glyf)
 
 		} else if bytes.Equal(trimLine, glyphOrder1) {
-			w.WriteString(`    <GlyphID id="999" name="uni01CD"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01CE"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01CF"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01D0"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01D1"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01D2"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01D3"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01D4"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01D5"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01D6"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01D7"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01D8"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01D9"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01DA"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01DB"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni01DC"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni037E"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2070"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2074"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2075"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2076"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2077"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2078"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2079"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni207A"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni207B"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni207C"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni207D"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni207E"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2080"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2081"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2082"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2083"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2084"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2085"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2086"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2087"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2088"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2089"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni208A"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni208B"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni208C"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni208D"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni208E"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="uni2099"/>` + "\n")
-			w.WriteString(`    <GlyphID id="999" name="union"/>` + "\n")
+			for _, r := range repertoire.GoFontsV2010Additions {
+				fmt.Fprintf(w, `    <GlyphID id="999" name="%s"/>`+"\n", newGlyphName(r))
+			}
 
 		} else if bytes.Equal(trimLine, hmtx1) {
 			writeMap(w, hmtx)
@@ -207,7 +166,7 @@ func do(filename string) {
 
 	out3TTFFilename := "/tmp/" + filename + ".ttf"
 	if err := exec.Command("ttfautohint", out2TTFFilename, out3TTFFilename).Run(); err != nil {
-		log.Fatalf("ttfautohint", err)
+		log.Fatalf("ttfautohint: %v", err)
 	}
 
 	os.Remove(inTTXFilename)
@@ -789,6 +748,39 @@ func (g glyph) render(name string) []byte {
 	return b.Bytes()
 }
 
+// newGlyphName returns the name of the glyph synthesized for r, one of the
+// repertoire.GoFontsV2010Additions.
+func newGlyphName(r rune) string {
+	if r == 0x222A {
+		return "union"
+	}
+	return fmt.Sprintf("uni%04X", r)
+}
+
+// mapCodes returns the cmap table entries for s, as ttx XML.
+func mapCodes(s repertoire.Set) []byte {
+	b := []byte(nil)
+	for i, r := range s {
+		if i > 0 {
+			b = append(b, "\n      "...)
+		}
+		b = append(b, fmt.Sprintf(`<map code="0x%x" name="%s"/>`, r, newGlyphName(r))...)
+	}
+	return b
+}
+
+// psNames returns the post table extraNames entries for s, as ttx XML.
+func psNames(s repertoire.Set) []byte {
+	b := []byte(nil)
+	for i, r := range s {
+		if i > 0 {
+			b = append(b, "\n      "...)
+		}
+		b = append(b, fmt.Sprintf(`<psName name="%s"/>`, newGlyphName(r))...)
+	}
+	return b
+}
+
 var (
 	cmap0       = []byte("<cmap>")
 	cmap1       = []byte("</cmap>")
@@ -812,111 +804,23 @@ var (
 	xQuote     = []byte(`x="`)
 	yQuote     = []byte(`y="`)
 
-	mapCode1cdEtc = []byte(`` +
-		`<map code="0x1cd" name="uni01CD"/>` + "\n      " +
-		`<map code="0x1ce" name="uni01CE"/>` + "\n      " +
-		`<map code="0x1cf" name="uni01CF"/>` + "\n      " +
-		`<map code="0x1d0" name="uni01D0"/>` + "\n      " +
-		`<map code="0x1d1" name="uni01D1"/>` + "\n      " +
-		`<map code="0x1d2" name="uni01D2"/>` + "\n      " +
-		`<map code="0x1d3" name="uni01D3"/>` + "\n      " +
-		`<map code="0x1d4" name="uni01D4"/>` + "\n      " +
-		`<map code="0x1d5" name="uni01D5"/>` + "\n      " +
-		`<map code="0x1d6" name="uni01D6"/>` + "\n      " +
-		`<map code="0x1d7" name="uni01D7"/>` + "\n      " +
-		`<map code="0x1d8" name="uni01D8"/>` + "\n      " +
-		`<map code="0x1d9" name="uni01D9"/>` + "\n      " +
-		`<map code="0x1da" name="uni01DA"/>` + "\n      " +
-		`<map code="0x1db" name="uni01DB"/>` + "\n      " +
-		`<map code="0x1dc" name="uni01DC"/>`)
+	mapCode1cdEtc  = mapCodes(repertoire.Pinyin)
 	mapCode1fa     = []byte(`<map code="0x1fa" name="Aringacute"/><!-- LATIN CAPITAL LETTER A WITH RING ABOVE AND ACUTE -->`)
-	mapCode37e     = []byte(`<map code="0x37e" name="uni037E"/>`)
+	mapCode37e     = mapCodes(repertoire.Of(0x037E))
 	mapCode384     = []byte(`<map code="0x384" name="tonos"/><!-- GREEK TONOS -->`)
-	mapCode2070Etc = []byte(`` +
-		`<map code="0x2070" name="uni2070"/>` + "\n      " +
-		`<map code="0x2074" name="uni2074"/>` + "\n      " +
-		`<map code="0x2075" name="uni2075"/>` + "\n      " +
-		`<map code="0x2076" name="uni2076"/>` + "\n      " +
-		`<map code="0x2077" name="uni2077"/>` + "\n      " +
-		`<map code="0x2078" name="uni2078"/>` + "\n      " +
-		`<map code="0x2079" name="uni2079"/>` + "\n      " +
-		`<map code="0x207A" name="uni207A"/>` + "\n      " +
-		`<map code="0x207B" name="uni207B"/>` + "\n      " +
-		`<map code="0x207C" name="uni207C"/>` + "\n      " +
-		`<map code="0x207D" name="uni207D"/>` + "\n      " +
-		`<map code="0x207E" name="uni207E"/>` + "\n      " +
-		`<map code="0x2080" name="uni2080"/>` + "\n      " +
-		`<map code="0x2081" name="uni2081"/>` + "\n      " +
-		`<map code="0x2082" name="uni2082"/>` + "\n      " +
-		`<map code="0x2083" name="uni2083"/>` + "\n      " +
-		`<map code="0x2084" name="uni2084"/>` + "\n      " +
-		`<map code="0x2085" name="uni2085"/>` + "\n      " +
-		`<map code="0x2086" name="uni2086"/>` + "\n      " +
-		`<map code="0x2087" name="uni2087"/>` + "\n      " +
-		`<map code="0x2088" name="uni2088"/>` + "\n      " +
-		`<map code="0x2089" name="uni2089"/>` + "\n      " +
-		`<map code="0x208A" name="uni208A"/>` + "\n      " +
-		`<map code="0x208B" name="uni208B"/>` + "\n      " +
-		`<map code="0x208C" name="uni208C"/>` + "\n      " +
-		`<map code="0x208D" name="uni208D"/>` + "\n      " +
-		`<map code="0x208E" name="uni208E"/>` + "\n      " +
-		`<map code="0x2099" name="uni2099"/>`)
-	mapCode20a3 = []byte(`<map code="0x20a3" name="franc"/><!-- FRENCH FRANC SIGN -->`)
-	mapCode222a = []byte(`<map code="0x222a" name="union"/>`)
-	mapCode222b = []byte(`<map code="0x222b" name="integral"/><!-- INTEGRAL -->`)
-
-	psNameUni01CDEtc = []byte(`` +
-		`<psName name="uni01CD"/>` + "\n      " +
-		`<psName name="uni01CE"/>` + "\n      " +
-		`<psName name="uni01CF"/>` + "\n      " +
-		`<psName name="uni01D0"/>` + "\n      " +
-		`<psName name="uni01D1"/>` + "\n      " +
-		`<psName name="uni01D2"/>` + "\n      " +
-		`<psName name="uni01D3"/>` + "\n      " +
-		`<psName name="uni01D4"/>` + "\n      " +
-		`<psName name="uni01D5"/>` + "\n      " +
-		`<psName name="uni01D6"/>` + "\n      " +
-		`<psName name="uni01D7"/>` + "\n      " +
-		`<psName name="uni01D8"/>` + "\n      " +
-		`<psName name="uni01D9"/>` + "\n      " +
-		`<psName name="uni01DA"/>` + "\n      " +
-		`<psName name="uni01DB"/>` + "\n      " +
-		`<psName name="uni01DC"/>`)
+	mapCode2070Etc = mapCodes(repertoire.SuperscriptsSubscripts)
+	mapCode20a3    = []byte(`<map code="0x20a3" name="franc"/><!-- FRENCH FRANC SIGN -->`)
+	mapCode222a    = mapCodes(repertoire.Of(0x222A))
+	mapCode222b    = []byte(`<map code="0x222b" name="integral"/><!-- INTEGRAL -->`)
+
+	psNameUni01CDEtc = psNames(repertoire.Pinyin)
 	psNameUni0218    = []byte(`<psName name="uni0218"/>`)
-	psNameUni037E    = []byte(`<psName name="uni037E"/>`)
+	psNameUni037E    = psNames(repertoire.Of(0x037E))
 	psNameUni0394    = []byte(`<psName name="uni0394"/>`)
-	psNameUni2070Etc = []byte(`` +
-		`<psName name="uni2070"/>` + "\n      " +
-		`<psName name="uni2074"/>` + "\n      " +
-		`<psName name="uni2075"/>` + "\n      " +
-		`<psName name="uni2076"/>` + "\n      " +
-		`<psName name="uni2077"/>` + "\n      " +
-		`<psName name="uni2078"/>` + "\n      " +
-		`<psName name="uni2079"/>` + "\n      " +
-		`<psName name="uni207A"/>` + "\n      " +
-		`<psName name="uni207B"/>` + "\n      " +
-		`<psName name="uni207C"/>` + "\n      " +
-		`<psName name="uni207D"/>` + "\n      " +
-		`<psName name="uni207E"/>` + "\n      " +
-		`<psName name="uni2080"/>` + "\n      " +
-		`<psName name="uni2081"/>` + "\n      " +
-		`<psName name="uni2082"/>` + "\n      " +
-		`<psName name="uni2083"/>` + "\n      " +
-		`<psName name="uni2084"/>` + "\n      " +
-		`<psName name="uni2085"/>` + "\n      " +
-		`<psName name="uni2086"/>` + "\n      " +
-		`<psName name="uni2087"/>` + "\n      " +
-		`<psName name="uni2088"/>` + "\n      " +
-		`<psName name="uni2089"/>` + "\n      " +
-		`<psName name="uni208A"/>` + "\n      " +
-		`<psName name="uni208B"/>` + "\n      " +
-		`<psName name="uni208C"/>` + "\n      " +
-		`<psName name="uni208D"/>` + "\n      " +
-		`<psName name="uni208E"/>` + "\n      " +
-		`<psName name="uni2099"/>`)
-	psNameUni2105 = []byte(`<psName name="uni2105"/>`)
-	psNameUnion   = []byte(`<psName name="union"/>`)
-	psNameUogonek = []byte(`<psName name="uogonek"/>`)
+	psNameUni2070Etc = psNames(repertoire.SuperscriptsSubscripts)
+	psNameUni2105    = []byte(`<psName name="uni2105"/>`)
+	psNameUnion      = psNames(repertoire.Of(0x222A))
+	psNameUogonek    = []byte(`<psName name="uogonek"/>`)
 
 	indent6 = []byte("      ")
 )
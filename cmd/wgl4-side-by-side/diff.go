@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"log"
+	"os"
+
+	"github.com/nigeltao/fontscripts/repertoire"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/unicode/runenames"
+)
+
+// diffScore measures how differently two faces rasterize a glyph.
+type diffScore struct {
+	// Changed is the number of pixels whose coverage differs at all.
+	Changed int
+	// MaxDelta is the largest coverage difference, from 0 to 255.
+	MaxDelta int
+	// IoU is the intersection over union of the two coverages, where each
+	// pixel's coverage counts fractionally. It is 1 for identical rasters,
+	// including two empty ones, and 0 for disjoint ones.
+	IoU float64
+}
+
+// exceeds returns whether the score is above the -tolerance threshold.
+func (s diffScore) exceeds() bool {
+	return s.Changed > *toleranceFlag
+}
+
+// glyphDiff is the diffScore for one rune, one pair of source fonts, given by
+// their indexes j0 and j1, and one variant v. k is the pair and variant's
+// overlay column.
+type glyphDiff struct {
+	c      rune
+	k      int
+	j0, j1 int
+	v      int
+	a0, a1 *image.Alpha
+	diffScore
+}
+
+// compare returns the diffScore of two rasterize images.
+func compare(a0, a1 *image.Alpha) diffScore {
+	s := diffScore{}
+	intersection, union := 0, 0
+	for i, p0 := range a0.Pix {
+		p1 := a1.Pix[i]
+		lo, hi := int(p0), int(p1)
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		if delta := hi - lo; delta > 0 {
+			s.Changed++
+			if s.MaxDelta < delta {
+				s.MaxDelta = delta
+			}
+		}
+		intersection += lo
+		union += hi
+	}
+	s.IoU = 1
+	if union != 0 {
+		s.IoU = float64(intersection) / float64(union)
+	}
+	return s
+}
+
+// diffPairIndexes returns which pairs of source fonts -diff compares. By
+// default, it is the 0th and 1st fonts, the 2nd and 3rd fonts, and so on.
+// With -ref, it is the reference font and each other font. With -chain, it is
+// each font and the one after it.
+func diffPairIndexes() [][2]int {
+	ret := [][2]int(nil)
+	switch {
+	case *refFlag >= 0:
+		for j := range names {
+			if j != *refFlag {
+				ret = append(ret, [2]int{*refFlag, j})
+			}
+		}
+	case *chainFlag:
+		for j := 1; j < len(names); j++ {
+			ret = append(ret, [2]int{j - 1, j})
+		}
+	default:
+		for j := 0; j+1 < len(names); j += 2 {
+			ret = append(ret, [2]int{j + 0, j + 1})
+		}
+	}
+	return ret
+}
+
+// diffPairs returns the glyphDiffs, for c, of each of the diffPairIndexes and
+// each variant.
+func diffPairs(fs *faceSet, c rune) []glyphDiff {
+	s := string(c)
+	ret := []glyphDiff(nil)
+	for k, p := range diffPairIndexes() {
+		for v := range variants {
+			a0 := rasterize(fs.large[column(p[0], v)], s)
+			a1 := rasterize(fs.large[column(p[1], v)], s)
+			ret = append(ret, glyphDiff{
+				c:         c,
+				k:         k*len(variants) + v,
+				j0:        p[0],
+				j1:        p[1],
+				v:         v,
+				a0:        a0,
+				a1:        a1,
+				diffScore: compare(a0, a1),
+			})
+		}
+	}
+	return ret
+}
+
+// printDiffSummary prints those glyphDiffs that exceed the -tolerance.
+func printDiffSummary(w io.Writer, ds []glyphDiff) {
+	for _, d := range ds {
+		if !d.exceeds() {
+			continue
+		}
+		fmt.Fprintf(w, "U+%04X fonts %d vs %d at %s: changed %d, max delta %d, IoU %.3f  %s\n",
+			d.c, d.j0, d.j1, variants[d.v].label, d.Changed, d.MaxDelta, d.IoU, runenames.Name(d.c))
+	}
+}
+
+// writeOverlay writes an image of those glyphDiffs that exceed the -tolerance,
+// one row per glyph and one column per pair of source fonts and variant.
+// Coverage by only the first of the pair is red, by only the second is green
+// and by both is black. Nothing is written if no glyphDiffs exceed the
+// -tolerance.
+func writeOverlay(fs *faceSet, page repertoire.Set, ds []glyphDiff, stdout io.Writer) {
+	rows := map[rune]bool{}
+	for _, d := range ds {
+		if d.exceeds() {
+			rows[d.c] = true
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	cellWidth := width * 2
+	cellHeight := (largeHeight * 3) / 2
+	nPairs := len(diffPairIndexes()) * len(variants)
+
+	dst := image.NewRGBA(image.Rect(0, 0, cellWidth*nPairs+listLabelWidth, cellHeight*len(rows)))
+	bounds := dst.Bounds()
+	draw.Draw(dst, bounds, image.White, image.Point{}, draw.Src)
+
+	gray := image.NewUniform(color.RGBA{0x80, 0x80, 0x80, 0xff})
+	d := &font.Drawer{
+		Dst: dst,
+	}
+	y := 0
+	for _, c := range page {
+		if !rows[c] {
+			continue
+		}
+		for _, g := range ds {
+			if g.c != c {
+				continue
+			}
+			x := cellWidth * g.k
+			drawOverlay(dst, image.Pt(x, y), g.a0, g.a1)
+			if g.exceeds() {
+				d.Src = image.Black
+				d.Face = fs.labelTiny
+				d.Dot = fixed.P(x+4, y+12)
+				d.DrawString(fmt.Sprintf("%d vs %d, %s", g.j0, g.j1, variants[g.v].label))
+				d.Dot = fixed.P(x+4, y+24)
+				d.DrawString(fmt.Sprintf("%d px, IoU %.3f", g.Changed, g.IoU))
+			}
+		}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			dst.SetRGBA(x, y+cellHeight-1, color.RGBA{0xe0, 0xe0, 0xe0, 0xff})
+		}
+
+		d.Src = image.Black
+		d.Face = fs.labelSmall
+		d.Dot = fixed.P(cellWidth*nPairs+16, y+cellHeight/2)
+		d.DrawString(fmt.Sprintf("U+%04X", c))
+
+		d.Src = gray
+		d.Face = fs.labelTiny
+		d.Dot = fixed.P(cellWidth*nPairs+16, y+cellHeight/2+12)
+		d.DrawString(runenames.Name(c))
+
+		y += cellHeight
+	}
+
+	filename := outputFilename(page[0], page[len(page)-1]+1, "-overlay.png")
+	outFile, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outFile.Close()
+	b := bufio.NewWriter(outFile)
+	err = png.Encode(b, dst)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = b.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(stdout, "Wrote %s\n", filename)
+}
+
+// drawOverlay draws the bottom three quarters of the a0 and a1 rasterize
+// images, in red and green, with its top-left corner at p.
+func drawOverlay(dst *image.RGBA, p image.Point, a0, a1 *image.Alpha) {
+	for y := largeHeight / 2; y < largeHeight*2; y++ {
+		for x := 0; x < width*2; x++ {
+			v0 := a0.AlphaAt(x, y).A
+			v1 := a1.AlphaAt(x, y).A
+			hi := v0
+			if hi < v1 {
+				hi = v1
+			}
+			dst.SetRGBA(p.X+x, p.Y+y-largeHeight/2, color.RGBA{0xff - v1, 0xff - v0, 0xff - hi, 0xff})
+		}
+	}
+}
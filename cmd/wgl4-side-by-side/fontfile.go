@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/nigeltao/fontscripts/fontfile"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// parseFont loads and parses the font file named by arg, as per fontfile.Load.
+// The truetype package only handles TrueType (glyf) outlines, but it applies
+// their hinting instructions, so the returned *truetype.Font is nil for other
+// fonts, such as CFF ones, which fall back to the opentype package.
+func parseFont(arg string) (*truetype.Font, *sfnt.Font, error) {
+	fontBytes, err := fontfile.Load(arg)
+	if err != nil {
+		return nil, nil, err
+	}
+	sf, err := sfnt.Parse(fontBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", arg, err)
+	}
+	tf, err := truetype.Parse(fontBytes)
+	if err != nil {
+		tf = nil
+	}
+	return tf, sf, nil
+}
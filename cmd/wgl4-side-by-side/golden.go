@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nigeltao/fontscripts/fontfile"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/unicode/runenames"
+)
+
+// goldenKey returns the -golden sub-directory for the i'th source font, whose
+// fontfile.Load arg is arg: its full name, such as "Go-Regular", without the
+// version that fontName adds, so that the goldens outlive font rebuilds.
+func goldenKey(i int, arg string) string {
+	var buf sfnt.Buffer
+	full, err := sfntFonts[i].Name(&buf, sfnt.NameIDFull)
+	if err != nil || full == "" {
+		full = fontfile.BaseName(arg)
+	}
+	return strings.Map(func(r rune) rune {
+		if ('0' <= r && r <= '9') || ('A' <= r && r <= 'Z') || ('a' <= r && r <= 'z') || r == '.' || r == '_' {
+			return r
+		}
+		return '-'
+	}, full)
+}
+
+// goldenFilename returns the golden PNG's filename for the given source font
+// key, variant and code point, such as "Go-Regular/48px-full-mono/0041.png".
+func goldenFilename(key string, va variant, c rune) string {
+	dir := fmt.Sprintf("%dpx-%s", va.ppem, strings.ReplaceAll(va.mode, "/", "-"))
+	return filepath.Join(*goldenFlag, key, dir, fmt.Sprintf("%04X.png", c))
+}
+
+// goldenRaster is like rasterize, but its image's size depends only on the
+// variant's size, not on the largest of the -sizes or on -cell, so that
+// adding sizes does not invalidate the goldens.
+func goldenRaster(face font.Face, ppem int, c rune) *image.Alpha {
+	n := 64
+	if m := (ppem*4 + 2) / 3; n < m {
+		n = m
+	}
+	dst := image.NewAlpha(image.Rect(0, 0, n*2, n*2))
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.White,
+		Face: face,
+		Dot:  fixed.P((n*1)/2, (n*3)/2),
+	}
+	d.DrawString(string(c))
+	return dst
+}
+
+// readGolden returns the golden PNG's coverage, or nil if there is no such
+// file. Goldens are stored as black glyphs on white, so that they are easy to
+// view.
+func readGolden(filename string) *image.Alpha {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	src, err := png.Decode(bufio.NewReader(f))
+	if err != nil {
+		log.Fatalf("%s: %v", filename, err)
+	}
+	b := src.Bounds()
+	dst := image.NewAlpha(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			g := color.GrayModel.Convert(src.At(b.Min.X+x, b.Min.Y+y)).(color.Gray)
+			dst.SetAlpha(x, y, color.Alpha{0xff - g.Y})
+		}
+	}
+	return dst
+}
+
+func writeGolden(filename string, a *image.Alpha) {
+	dst := image.NewGray(a.Bounds())
+	for i, p := range a.Pix {
+		dst.Pix[i] = 0xff - p
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		log.Fatal(err)
+	}
+	outFile, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outFile.Close()
+	b := bufio.NewWriter(outFile)
+	err = png.Encode(b, dst)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = b.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// checkGoldens compares every source font's glyph, for every variant, with
+// its golden PNG in the -golden directory, printing those with more than
+// -tolerance changed pixels, no golden or, if the font now lacks the glyph, a
+// stale golden. With -update, it then writes or removes those goldens to
+// match. Otherwise, it exits with a non-zero status if there were any.
+func checkGoldens(fs *faceSet, args []string) {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = goldenKey(i, arg)
+		for j := 0; j < i; j++ {
+			if keys[i] == keys[j] {
+				log.Fatalf("source fonts %d and %d have the same -golden key %q", j, i, keys[i])
+			}
+		}
+	}
+
+	checked, changed, added, stale := 0, 0, 0, 0
+	for _, c := range chars {
+		for j, face := range fs.large {
+			va := variants[j%len(variants)]
+			filename := goldenFilename(keys[j/len(variants)], va, c)
+			golden := readGolden(filename)
+
+			if isMissing(j, c) {
+				if golden != nil {
+					stale++
+					fmt.Printf("U+%04X %s %s: missing from the font  %s\n", c, keys[j/len(variants)], va.label, runenames.Name(c))
+					if *updateFlag {
+						if err := os.Remove(filename); err != nil {
+							log.Fatal(err)
+						}
+					}
+				}
+				continue
+			}
+
+			checked++
+			a := goldenRaster(face, va.ppem, c)
+			switch {
+			case golden == nil:
+				added++
+				fmt.Printf("U+%04X %s %s: no golden  %s\n", c, keys[j/len(variants)], va.label, runenames.Name(c))
+			case golden.Bounds() != a.Bounds():
+				changed++
+				fmt.Printf("U+%04X %s %s: golden is %v, not %v  %s\n",
+					c, keys[j/len(variants)], va.label, golden.Bounds().Size(), a.Bounds().Size(), runenames.Name(c))
+			default:
+				s := compare(golden, a)
+				if !s.exceeds() {
+					continue
+				}
+				changed++
+				fmt.Printf("U+%04X %s %s: changed %d, max delta %d, IoU %.3f  %s\n",
+					c, keys[j/len(variants)], va.label, s.Changed, s.MaxDelta, s.IoU, runenames.Name(c))
+			}
+			if *updateFlag {
+				writeGolden(filename, a)
+			}
+		}
+	}
+
+	fmt.Printf("Checked %d glyphs against %s: %d changed, %d without goldens, %d missing from the fonts\n",
+		checked, *goldenFlag, changed, added, stale)
+	if n := changed + added + stale; n > 0 {
+		if *updateFlag {
+			fmt.Printf("Updated %d goldens\n", n)
+		} else {
+			log.Fatalf("%d glyphs do not match their goldens; use -update to accept them", n)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nigeltao/fontscripts/repertoire"
+
+	"golang.org/x/image/font"
+	"golang.org/x/text/unicode/runenames"
+)
+
+type htmlBlock struct {
+	ID   string
+	Name string
+	Rows []htmlRow
+}
+
+type htmlRow struct {
+	ID    string
+	Code  string
+	Name  string
+	Cells []htmlCell
+}
+
+type htmlCell struct {
+	Src     template.URL
+	Diff    bool
+	Missing bool
+}
+
+// writeHTML writes the whole repertoire as a single, self-contained HTML
+// file, with the glyph rasters inlined as data: URLs.
+func writeHTML() {
+	blocks := []*htmlBlock(nil)
+	for _, c := range chars {
+		name := repertoire.Block(c)
+		if len(blocks) == 0 || blocks[len(blocks)-1].Name != name {
+			blocks = append(blocks, &htmlBlock{
+				ID:   "block-" + strings.ToLower(strings.NewReplacer(" ", "-", "_", "-").Replace(name)),
+				Name: name,
+			})
+		}
+		b := blocks[len(blocks)-1]
+		b.Rows = append(b.Rows, htmlRowFor(faces, c))
+	}
+
+	filename := outputFilename(chars[0], chars[len(chars)-1]+1, ".html")
+	outFile, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outFile.Close()
+	w := bufio.NewWriter(outFile)
+	columns := make([]string, len(faces.large))
+	for j := range columns {
+		columns[j] = fmt.Sprintf("%d %s", j/len(variants), variants[j%len(variants)].label)
+	}
+	footerNames := make([]string, len(names))
+	for i := range names {
+		footerNames[i] = footerName(i)
+	}
+	err = htmlTemplate.Execute(w, struct {
+		Names   []string
+		Columns []string
+		Blocks  []*htmlBlock
+	}{footerNames, columns, blocks})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = w.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %s\n", filename)
+}
+
+func htmlRowFor(fs *faceSet, c rune) htmlRow {
+	s := string(c)
+	row := htmlRow{
+		ID:    fmt.Sprintf("u%04X", c),
+		Code:  fmt.Sprintf("U+%04X", c),
+		Name:  runenames.Name(c),
+		Cells: make([]htmlCell, len(fs.large)),
+	}
+	for j, face := range fs.large {
+		if isMissing(j, c) {
+			row.Cells[j].Missing = true
+			continue
+		}
+		row.Cells[j].Src = pngDataURL(face, s)
+	}
+	if *diffFlag {
+		ds := diffPairs(fs, c)
+		for _, g := range ds {
+			if g.exceeds() {
+				row.Cells[column(g.j0, g.v)].Diff = true
+				row.Cells[column(g.j1, g.v)].Diff = true
+			}
+		}
+		printDiffSummary(os.Stdout, ds)
+		recordDiffs(ds)
+	}
+	return row
+}
+
+// pngDataURL returns a data: URL for a black on white PNG image of s, cropped
+// to the bottom three quarters of the rasterize image.
+func pngDataURL(face font.Face, s string) template.URL {
+	mask := rasterize(face, s)
+	r := image.Rect(0, largeHeight/2, width*2, largeHeight*2)
+	dst := image.NewGray(r)
+	draw.Draw(dst, r, image.White, image.Point{}, draw.Src)
+	draw.DrawMask(dst, r, image.Black, image.Point{}, mask, r.Min, draw.Over)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("data:image/png;base64,")
+	enc := base64.NewEncoder(base64.StdEncoding, buf)
+	if err := png.Encode(enc, dst); err != nil {
+		log.Fatal(err)
+	}
+	enc.Close()
+	return template.URL(buf.String())
+}
+
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>wgl4-side-by-side</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+tr { border-bottom: 1px solid #e0e0e0; }
+tr:target { background-color: #e0f0ff; }
+td { padding: 0 8px; }
+td.glyph { border-left: 1px solid #e0e0e0; }
+td.diff { background-color: #ffffcc; }
+td.missing { background-color: #ffc0c0; font-size: small; }
+td.name { color: #808080; font-size: small; }
+a.code { color: black; text-decoration: none; }
+</style>
+</head>
+<body>
+<ol start="0">
+{{range .Names}}<li>{{.}}</li>
+{{end}}</ol>
+<ul>
+{{range .Blocks}}<li><a href="#{{.ID}}">{{.Name}}</a></li>
+{{end}}</ul>
+<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Blocks}}<tr id="{{.ID}}"><th colspan="{{len (index .Rows 0).Cells}}"></th><th colspan="2" align="left"><h2>{{.Name}}</h2></th></tr>
+{{range .Rows}}<tr id="{{.ID}}">{{range .Cells}}<td class="glyph{{if .Diff}} diff{{end}}{{if .Missing}} missing{{end}}">{{if .Missing}}missing{{else}}<img src="{{.Src}}" alt="">{{end}}</td>{{end}}<td><a class="code" href="#{{.ID}}">{{.Code}}</a></td><td class="name">{{.Name}}</td></tr>
+{{end}}{{end}}</table>
+</body>
+</html>
+`))
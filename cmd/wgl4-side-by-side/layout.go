@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+
+	"github.com/golang/freetype/truetype"
+
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+)
+
+// listLabelWidth is the width, right of a list page's glyph columns, of each
+// row's code point and name labels.
+const listLabelWidth = 384
+
+// theme is the colours of a PNG or SVG page.
+type theme struct {
+	background color.RGBA
+	foreground color.RGBA
+	// label is for secondary labels, such as Unicode names.
+	label color.RGBA
+	// rule is for the lines between rows and columns, and separator is for
+	// the heavier lines between waterfall glyphs.
+	rule      color.RGBA
+	separator color.RGBA
+	// diff and missing are the backgrounds of differing and missing cells.
+	diff    color.RGBA
+	missing color.RGBA
+}
+
+var themes = map[string]theme{
+	"light": {
+		background: color.RGBA{0xff, 0xff, 0xff, 0xff},
+		foreground: color.RGBA{0x00, 0x00, 0x00, 0xff},
+		label:      color.RGBA{0x80, 0x80, 0x80, 0xff},
+		rule:       color.RGBA{0xe0, 0xe0, 0xe0, 0xff},
+		separator:  color.RGBA{0xc0, 0xc0, 0xc0, 0xff},
+		diff:       color.RGBA{0xff, 0xff, 0xcc, 0xff},
+		missing:    color.RGBA{0xff, 0xc0, 0xc0, 0xff},
+	},
+	"dark": {
+		background: color.RGBA{0x1c, 0x1c, 0x1c, 0xff},
+		foreground: color.RGBA{0xf0, 0xf0, 0xf0, 0xff},
+		label:      color.RGBA{0x90, 0x90, 0x90, 0xff},
+		rule:       color.RGBA{0x38, 0x38, 0x38, 0xff},
+		separator:  color.RGBA{0x58, 0x58, 0x58, 0xff},
+		diff:       color.RGBA{0x50, 0x4c, 0x10, 0xff},
+		missing:    color.RGBA{0x60, 0x28, 0x28, 0xff},
+	},
+}
+
+// colors is the -theme's colours.
+var colors theme
+
+// svgColor returns c as an SVG colour, such as "#e0e0e0".
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// loadLabelFont returns the -labelfont, or Go Regular by default. Like
+// parseFont, the *truetype.Font is nil for fonts without TrueType outlines.
+func loadLabelFont() (*truetype.Font, *sfnt.Font) {
+	if *labelFontFlag != "" {
+		tf, sf, err := parseFont(*labelFontFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return tf, sf
+	}
+	tf, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sf, err := sfnt.Parse(goregular.TTF)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return tf, sf
+}
+
+// tileWidth and tileHeight are the size of a -layout=grid page's tiles: each
+// holds one glyph's columns and, below them, its code point.
+func tileWidth() int {
+	return width*len(names)*len(variants) + width/2
+}
+
+func tileHeight() int {
+	return (largeHeight*5)/4 + 16
+}
+
+// cellOrigin returns the dot (the glyph origin) of the j'th column of a page's
+// i'th glyph. A list page has one row per glyph and a grid page has one tile
+// per glyph, -columns tiles per row.
+func cellOrigin(i, j int) (x, y int) {
+	x, y = width*j+width/4, largeHeight*(i+1)
+	if *layoutFlag == "grid" {
+		x += (i % *columnsFlag) * tileWidth()
+		y = (i / *columnsFlag)*tileHeight() + largeHeight
+	}
+	return x, y
+}
+
+// cellRect returns the background of the j'th column of a page's i'th glyph,
+// which is filled for differing or missing glyphs.
+func cellRect(i, j int) image.Rectangle {
+	x, y := cellOrigin(i, j)
+	x -= width / 4
+	return image.Rect(
+		x+(width/8),
+		y-(1*largeHeight)+(largeHeight/8),
+		x+width+(width/8),
+		y-(0*largeHeight)+(largeHeight/8),
+	)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// linesLabelWidth is the width of the column, left of the sample lines, that
+// labels each row with its source font and variant.
+const linesLabelWidth = 192
+
+// loadLines returns the non-empty lines of the -lines file, less any that
+// start with a '#'.
+func loadLines() []string {
+	f, err := os.Open(*linesFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	ret := []string(nil)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ret = append(ret, line)
+	}
+	if err := s.Err(); err != nil {
+		log.Fatalf("%s: %v", *linesFlag, err)
+	}
+	if len(ret) == 0 {
+		log.Fatalf("%s: no sample lines", *linesFlag)
+	}
+	return ret
+}
+
+// linesRowHeight is the height of a sample line's row for the v'th variant:
+// like a cell's height, but fitting that variant's size instead of the
+// largest variant's size.
+func linesRowHeight(v int) int {
+	if h := (variants[v].ppem*4 + 2) / 3; h > 16 {
+		return h
+	}
+	return 16
+}
+
+// linesGroupHeight is the height of each sample line's rows: one per column
+// and a gap.
+func linesGroupHeight() int {
+	h := 0
+	for v := range variants {
+		h += linesRowHeight(v)
+	}
+	return h*len(names) + largeHeight/2
+}
+
+// writeLines writes the sample lines, split into pages no taller than
+// -maxheight, with one row per column for each sample line.
+func writeLines(lines []string) {
+	perPage := (*maxHeightFlag - largeHeight) / linesGroupHeight()
+	if perPage < 1 {
+		perPage = 1
+	}
+	for i := 0; i < len(lines); i += perPage {
+		j := i + perPage
+		if j > len(lines) {
+			j = len(lines)
+		}
+		doLines(faces, lines[i:j], i)
+	}
+}
+
+// doLines is like do, but draws whole lines of text, kerned by each face's
+// Kern method, instead of isolated runes. The page's filename's .Lo and .Hi
+// are the range of line numbers, counting from 0, of the -lines file's sample
+// lines.
+func doLines(fs *faceSet, lines []string, lo int) {
+	textWidth := 0
+	for _, line := range lines {
+		for _, face := range fs.large {
+			if w := font.MeasureString(face, line).Ceil(); textWidth < w {
+				textWidth = w
+			}
+		}
+	}
+	yMax := linesGroupHeight()*len(lines) + largeHeight/2
+
+	w := linesLabelWidth + textWidth + 32
+	if fw := footerWidth(fs); w < fw {
+		w = fw
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, yMax+footerHeight()))
+	bounds := dst.Bounds()
+	draw.Draw(dst, bounds, image.NewUniform(colors.background), image.Point{}, draw.Src)
+
+	fg := image.NewUniform(colors.foreground)
+	gray := image.NewUniform(colors.label)
+	d := &font.Drawer{
+		Dst: dst,
+	}
+	y := 0
+	for _, line := range lines {
+		for j, face := range fs.large {
+			h := linesRowHeight(j % len(variants))
+			y += h
+			hLine(dst, bounds.Min.X, bounds.Max.X-1, y, colors.rule)
+
+			d.Src = gray
+			d.Face = fs.labelTiny
+			d.Dot = fixed.P(16, y)
+			d.DrawString(fmt.Sprintf("%d %s", j/len(variants), variants[j%len(variants)].label))
+
+			d.Src = fg
+			d.Face = face
+			d.Dot = fixed.P(linesLabelWidth, y)
+			drawKerned(dst, d, line, y-h, y+h/4)
+		}
+		y += largeHeight / 2
+	}
+
+	for i, s := range names {
+		d.Src = fg
+		d.Face = fs.small[i]
+		d.Dot = fixed.P(16, yMax+(i+1)*smallHeight)
+		d.DrawString(s)
+	}
+	if len(variants) > 1 && !*waterfallFlag {
+		d.Src = gray
+		d.Face = fs.labelSmall
+		d.Dot = fixed.P(16, yMax+(len(names)+1)*smallHeight)
+		d.DrawString("Columns per font: " + variantLabels())
+	}
+
+	filename := namedFilename(strconv.Itoa(lo), strconv.Itoa(lo+len(lines)), "-lines.png")
+	outFile, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outFile.Close()
+	b := bufio.NewWriter(outFile)
+	err = png.Encode(b, dst)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = b.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %s\n", filename)
+}
+
+// drawKerned draws s like d.DrawString, applying the same kerning. With
+// -guides, it also draws a vertical line, from y0 to y1, at each glyph's
+// origin: blue if unkerned and red if kerned.
+func drawKerned(dst *image.RGBA, d *font.Drawer, s string, y0, y1 int) {
+	blue := color.RGBA{0x80, 0xc0, 0xff, 0xff}
+	red := color.RGBA{0xff, 0x00, 0x00, 0xff}
+	prev := rune(-1)
+	for _, c := range s {
+		kern := fixed.Int26_6(0)
+		if prev >= 0 {
+			kern = d.Face.Kern(prev, c)
+			d.Dot.X += kern
+		}
+		if *guidesFlag {
+			guide := blue
+			if kern != 0 {
+				guide = red
+			}
+			x := d.Dot.X.Round()
+			for y := y0; y < y1; y++ {
+				dst.SetRGBA(x, y, guide)
+			}
+		}
+		d.DrawString(string(c))
+		prev = c
+	}
+}
@@ -1,5 +1,108 @@
-// wgl4-side-by-side prints the glyphs of the WGL-4 repertoire from the given
-// TrueType fonts.
+// wgl4-side-by-side prints the glyphs of the Go fonts' repertoire (the WGL-4
+// repertoire plus some additions) from the given fonts.
+//
+// The fonts can be TrueType (.ttf) or CFF-flavored OpenType (.otf) fonts,
+// WOFF (.woff) or WOFF2 (.woff2) web fonts, or individual fonts of a TrueType
+// or OpenType collection (.ttc or .otc), selected by an index suffix such as
+// "NotoSansCJK.ttc#2". Only TrueType outlines' hinting instructions are
+// applied.
+//
+// The -repertoire flag selects a different repertoire: either a name that the
+// github.com/nigeltao/fontscripts/repertoire package knows, such as "wgl4" or
+// "latin1", or the filename of a repertoire file, with one code point (such
+// as "1EA0") or range (such as "1EA0..1EF9") per line. Alternatively, the
+// -text flag gives sample text whose distinct characters are the repertoire.
+// The repertoire is split into pages of at most -perpage glyphs each, and
+// further split so that no page's glyph rows are taller than -maxheight
+// pixels. Each page is only as tall as its rows.
+//
+// Each page is written to the -out directory. Its filename, less the ".png"
+// extension, is given by the -name flag, a text/template whose data has these
+// string fields:
+//   - .Lo and .Hi are the page's code point range, in hex, such as "0100".
+//   - .Fonts are the source fonts' filenames, less directories and
+//     extensions, joined by "+".
+//   - .Timestamp is when the program started, such as "20220413T100746".
+//
+// For example, -name='{{.Timestamp}}/{{.Fonts}}-{{.Lo}}' writes each run's
+// pages to a new sub-directory.
+//
+// With -format=html, the whole repertoire is written to a single,
+// self-contained HTML file instead of PNG pages, with anchors for each
+// Unicode block and each code point.
+//
+// With -format=svg, each page is written as an SVG image of the glyphs'
+// vector outlines instead of as a PNG image. The -points flag marks the
+// outlines' on-curve (red) and off-curve (blue) points and the -guides flag
+// draws each glyph's baseline and advance width.
+//
+// With -diff, the 0th and 1st source fonts are compared, as are the 2nd and
+// 3rd, and so on. With -ref=i, the i'th source font is instead compared with
+// every other source font, and with -chain, each source font is compared with
+// the one before it. A pair's glyphs are highlighted if more than -tolerance of
+// their pixels differ, and each such glyph is listed with its changed pixel
+// count, maximum coverage delta and coverage IoU (intersection over union).
+// For PNG pages, the differing glyphs are also drawn to a "-overlay.png"
+// image, in red for the first of the pair and in green for the second.
+// Diffing works on the rasterized glyphs of PNG or HTML pages, not SVG ones.
+//
+// For CI, -report writes every comparison of PNG or HTML pages, differing or
+// not, to a JSON file, and -allow gives the code points that are expected to
+// differ, as a repertoire name or filename like -repertoire. If any other
+// code point differs, the program exits with a non-zero status after
+// writing its pages. Both flags imply -diff.
+//
+// The -sizes, -hinting and -render flags give comma-separated lists of pixel
+// sizes (such as "48,24,12"), hinting modes ("none", "vertical" or "full") and
+// rendering modes ("aa" for antialiased or "mono" for 1-bit monochrome). Each
+// source font gets one column per combination, so that hinting regressions
+// show up next to each other. Cells grow to fit the largest size. The SVG
+// outlines are never hinted or monochrome.
+//
+// The -waterfall flag replaces -sizes with a ladder of sizes from 8 to 72
+// pixels. Each glyph gets one row per source font and hinting and rendering
+// mode, with the sizes from left to right. With -lines, each sample line gets
+// one row per size instead.
+//
+// Cells for code points that a source font's cmap lacks are coloured pink
+// and labelled "missing" instead of showing the .notdef glyph, and the footer
+// counts each source font's missing code points.
+//
+// The -metrics flag draws lines behind each glyph in the PNG pages: the face's
+// ascent and descent (blue), cap-height (red), x-height (green) and baseline
+// (grey), and the glyph's advance width (orange) and bounding box (magenta).
+//
+// The -lines flag gives the filename of sample lines of text, such as
+// pangrams, spacing strings like "HH?HH" or lists of kerning pairs like
+// "AV Ta Yo", one per line. Each line is drawn whole, kerned, by each column,
+// to review spacing and sidebearings instead of isolated glyphs. Blank lines
+// and lines starting with '#' are ignored. The pages' .Lo and .Hi are decimal
+// line numbers, and -guides marks each glyph's origin, in red if it was
+// kerned.
+//
+// The -cell flag sets each glyph cell's size in pixels, instead of fitting the
+// largest -sizes, and -labelfont gives the font file for the labels, instead
+// of Go Regular. With -layout=grid, PNG pages are compact contact sheets of
+// -columns glyphs per row, each labelled with just its code point, instead of
+// the default list of one glyph per row. The -theme flag colours PNG and SVG
+// pages "light" (the default) or "dark".
+//
+// PNG and SVG pages are rendered concurrently by up to -j workers, which
+// defaults to the number of CPUs. Each worker has its own faces, and the
+// pages' output is printed in order.
+//
+// With -serve=:8080, no files are written. Instead, an HTTP server renders
+// pages on demand, with the fonts, size, hinting, code point range and diff
+// highlighting chosen in the browser. Clicking a glyph shows a zoomed raster.
+// Source font files are re-read when they change.
+//
+// With -golden=dir, no pages are written. Instead, each source font's glyph
+// for each code point and variant is compared with a golden PNG, such as
+// "dir/Go-Regular/48px-none/0041.png", keyed by the font's full name. Glyphs
+// with more than -tolerance changed pixels, glyphs without goldens and
+// goldens of glyphs that the font now lacks are listed, and the program exits
+// with a non-zero status. With -update, the goldens are instead updated to
+// match, so the first run of a new font should use -update.
 package main
 
 import (
@@ -8,40 +111,113 @@ import (
 	"flag"
 	"fmt"
 	"image"
-	"image/color"
 	"image/draw"
 	"image/png"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/golang/freetype/truetype"
+	"github.com/nigeltao/fontscripts/fontfile"
+	"github.com/nigeltao/fontscripts/repertoire"
 
 	"golang.org/x/image/font"
-	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
 	"golang.org/x/image/math/fixed"
 	"golang.org/x/text/unicode/runenames"
 )
 
 var (
-	diffFlag = flag.Bool("diff", false, "highlight differences between pairs of source fonts")
+	allowFlag      = flag.String("allow", "", "repertoire name or filename of code points that may differ; any other -diff difference exits non-zero")
+	cellFlag       = flag.Int("cell", 0, "size, in pixels, of each glyph's cell; 0 fits the largest of -sizes")
+	chainFlag      = flag.Bool("chain", false, "diff each source font against the previous one; implies -diff")
+	columnsFlag    = flag.Int("columns", 8, "number of glyphs per row of -layout=grid pages")
+	diffFlag       = flag.Bool("diff", false, "highlight differences between pairs of source fonts")
+	formatFlag     = flag.String("format", "png", `output format: "png", "html" or "svg"`)
+	hintingFlag    = flag.String("hinting", "none", `comma-separated hinting modes: "none", "vertical" or "full"`)
+	goldenFlag     = flag.String("golden", "", "directory of golden PNGs to compare each glyph with, instead of writing pages")
+	guidesFlag     = flag.Bool("guides", false, "draw baselines and advance widths (SVG), or glyph origins (-lines)")
+	jobsFlag       = flag.Int("j", runtime.GOMAXPROCS(0), "number of pages to render concurrently")
+	labelFontFlag  = flag.String("labelfont", "", "filename of the font for labels, instead of Go Regular")
+	layoutFlag     = flag.String("layout", "list", `PNG page layout: "list" (one row per glyph) or "grid" (-columns glyphs per row)`)
+	linesFlag      = flag.String("lines", "", "filename of sample lines to draw, kerned, instead of the repertoire (PNG only)")
+	nameFlag       = flag.String("name", "side-by-side-{{.Lo}}-{{.Hi}}", "output filename template, without the extension")
+	outFlag        = flag.String("out", ".", "output directory")
+	metricsFlag    = flag.Bool("metrics", false, "draw each glyph's vertical metrics, advance width and bounding box (PNG only)")
+	maxHeightFlag  = flag.Int("maxheight", 7168, "maximum height, in pixels, of each page's glyph rows")
+	perPageFlag    = flag.Int("perpage", 100, "maximum number of glyphs per page")
+	pointsFlag     = flag.Bool("points", false, "mark on-curve and off-curve points (SVG only)")
+	refFlag        = flag.Int("ref", -1, "index of a reference source font to diff every other font against; implies -diff")
+	reportFlag     = flag.String("report", "", "filename of a JSON report of every -diff comparison")
+	renderFlag     = flag.String("render", "aa", `comma-separated rendering modes: "aa" (antialiased) or "mono" (1-bit monochrome)`)
+	repertoireFlag = flag.String("repertoire", "go-fonts", "repertoire name or filename")
+	serveFlag      = flag.String("serve", "", "address, such as \":8080\", to serve an interactive viewer on instead of writing files")
+	sizesFlag      = flag.String("sizes", "48", "comma-separated pixel sizes")
+	textFlag       = flag.String("text", "", "sample text whose characters are the repertoire; overrides -repertoire")
+	themeFlag      = flag.String("theme", "light", `PNG and SVG page colours: "light" or "dark"`)
+	waterfallFlag  = flag.Bool("waterfall", false, "draw each glyph, or -lines sample line, at sizes from 8 to 72 pixels instead of -sizes")
+	updateFlag     = flag.Bool("update", false, "write -golden PNGs for new or changed glyphs")
+	toleranceFlag  = flag.Int("tolerance", 0, "number of changed pixels that -diff ignores")
 )
 
 const (
-	width       = 64
-	largeHeight = 64
 	smallHeight = 32
-	hinting     = font.HintingNone
+	smallPPEM   = 24
 )
 
-var (
-	names      []string
-	largeFaces []font.Face
-	smallFaces []font.Face
+var hintings = map[string]font.Hinting{
+	"none":     font.HintingNone,
+	"vertical": font.HintingVertical,
+	"full":     font.HintingFull,
+}
+
+// variant is a pixel size, hinting and rendering mode combination. Its mode
+// is its label less the size, such as "none" or "full/mono".
+type variant struct {
+	ppem    int
+	hinting font.Hinting
+	mono    bool
+	mode    string
+	label   string
+}
 
-	goregularFont      *truetype.Font
-	goregularSmallFace font.Face
-	goregularTinyFace  font.Face
+var (
+	chars repertoire.Set
+
+	// width and largeHeight are the size of each glyph's cell. They are at
+	// least 64, and large enough to fit the largest variant.
+	width       int
+	largeHeight int
+
+	// ttFonts[i] is nil if the i'th source font does not have TrueType
+	// outlines, in which case its faces come from sfntFonts[i].
+	variants  []variant
+	names     []string
+	ttFonts   []*truetype.Font
+	sfntFonts []*sfnt.Font
+	missing   []repertoire.Set
+
+	// labelTTFont is nil if the -labelfont does not have TrueType outlines,
+	// like ttFonts.
+	labelTTFont   *truetype.Font
+	labelSFNTFont *sfnt.Font
+
+	// faces is the main goroutine's faceSet.
+	faces *faceSet
+
+	nameTemplate *template.Template
+	nameData     struct {
+		Lo, Hi    string
+		Fonts     string
+		Timestamp string
+	}
 )
 
 func main() {
@@ -52,162 +228,420 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *formatFlag != "png" && *formatFlag != "html" && *formatFlag != "svg" {
+		log.Fatalf("unknown -format %q", *formatFlag)
+	}
+	variants = loadVariants()
+	width, largeHeight = 64, 64
+	for _, v := range variants {
+		if n := (v.ppem*4 + 2) / 3; largeHeight < n {
+			width, largeHeight = n, n
+		}
+	}
+	if *cellFlag != 0 {
+		if *cellFlag < 16 {
+			log.Fatalf("invalid -cell %d", *cellFlag)
+		}
+		width, largeHeight = *cellFlag, *cellFlag
+	}
+	if *layoutFlag != "list" && *layoutFlag != "grid" {
+		log.Fatalf("unknown -layout %q", *layoutFlag)
+	}
+	if *layoutFlag == "grid" && (*formatFlag != "png" || *waterfallFlag || *linesFlag != "") {
+		log.Fatal("-layout=grid needs PNG pages of the repertoire, without -waterfall")
+	}
+	if *columnsFlag <= 0 {
+		log.Fatalf("invalid -columns %d", *columnsFlag)
+	}
+	t, ok := themes[*themeFlag]
+	if !ok {
+		log.Fatalf("unknown -theme %q", *themeFlag)
+	}
+	colors = t
+	if *waterfallFlag && *formatFlag != "png" {
+		log.Fatalf("-waterfall does not support -format %q", *formatFlag)
+	}
+	if *linesFlag != "" && *formatFlag != "png" {
+		log.Fatalf("-lines does not support -format %q", *formatFlag)
+	}
+	if *jobsFlag <= 0 {
+		log.Fatalf("invalid -j %d", *jobsFlag)
+	}
+	if *perPageFlag <= 0 {
+		log.Fatalf("invalid -perpage %d", *perPageFlag)
+	}
+	if *refFlag < -1 {
+		log.Fatalf("invalid -ref %d", *refFlag)
+	} else if *refFlag >= len(args) {
+		log.Fatalf("invalid -ref %d: there are only %d source fonts", *refFlag, len(args))
+	}
+	if *refFlag >= 0 && *chainFlag {
+		log.Fatal("-ref and -chain are mutually exclusive")
+	}
+	if *refFlag >= 0 || *chainFlag || *reportFlag != "" || *allowFlag != "" {
+		*diffFlag = true
+	}
+	if *waterfallFlag && *diffFlag {
+		log.Fatal("-waterfall does not support -diff")
+	}
+	if (*reportFlag != "" || *allowFlag != "") && (*formatFlag == "svg" || *linesFlag != "") {
+		log.Fatal("-report and -allow need PNG or HTML pages of the repertoire")
+	}
+	if *diffFlag && *formatFlag == "svg" {
+		log.Fatal("-diff, -ref and -chain do not support -format svg")
+	}
+	if *goldenFlag != "" && (*diffFlag || *linesFlag != "") {
+		log.Fatal("-golden does not support -diff or -lines")
+	}
+	if *updateFlag && *goldenFlag == "" {
+		log.Fatal("-update needs -golden")
+	}
+	allowed = loadAllowed()
+	chars = loadRepertoire()
+	if len(chars) == 0 {
+		log.Fatal("empty repertoire")
+	}
+
 	var err error
-	goregularFont, err = truetype.Parse(goregular.TTF)
+	nameTemplate, err = template.New("name").Parse(*nameFlag)
 	if err != nil {
 		log.Fatal(err)
 	}
-	goregularSmallFace = truetype.NewFace(goregularFont, &truetype.Options{
-		Size:    24,
-		Hinting: hinting,
-	})
-	goregularTinyFace = truetype.NewFace(goregularFont, &truetype.Options{
-		Size:    10,
-		Hinting: hinting,
-	})
+	nameData.Timestamp = time.Now().Format("20060102T150405")
+	fontNames := make([]string, len(args))
+	for i, arg := range args {
+		fontNames[i] = fontfile.BaseName(arg)
+	}
+	nameData.Fonts = strings.Join(fontNames, "+")
+
+	labelTTFont, labelSFNTFont = loadLabelFont()
 
 	names = make([]string, len(args))
-	largeFaces = make([]font.Face, len(args))
-	smallFaces = make([]font.Face, len(args))
+	ttFonts = make([]*truetype.Font, len(args))
+	sfntFonts = make([]*sfnt.Font, len(args))
+	missing = make([]repertoire.Set, len(args))
 	for i, arg := range args {
-		fontBytes, err := ioutil.ReadFile(arg)
+		ttFonts[i], sfntFonts[i], err = parseFont(arg)
 		if err != nil {
 			log.Fatal(err)
 		}
-		f, err := truetype.Parse(fontBytes)
-		if err != nil {
-			log.Fatal(err)
+		missing[i] = missingChars(sfntFonts[i])
+		names[i] = fontName(sfntFonts[i])
+	}
+	faces = newFaceSet()
+
+	if *serveFlag != "" {
+		serve(args)
+		return
+	}
+
+	if *goldenFlag != "" {
+		checkGoldens(faces, args)
+		return
+	}
+	if *linesFlag != "" {
+		writeLines(loadLines())
+		return
+	}
+	if *formatFlag == "html" {
+		writeHTML()
+		finishReport(args)
+		return
+	}
+
+	if *maxHeightFlag < pageHeight(1) {
+		log.Fatalf("invalid -maxheight %d: a single row needs %d", *maxHeightFlag, pageHeight(1))
+	}
+	perPage := *perPageFlag
+	for pageHeight(perPage) > *maxHeightFlag {
+		perPage--
+	}
+	pages := []repertoire.Set(nil)
+	for page := chars; len(page) > 0; {
+		n := perPage
+		if n > len(page) {
+			n = len(page)
 		}
-		names[i] = fmt.Sprintf("%s; %s",
-			f.Name(truetype.NameIDFontFullName),
-			f.Name(truetype.NameIDNameTableVersion),
-		)
-		largeFaces[i] = truetype.NewFace(f, &truetype.Options{
-			Size:    48,
-			Hinting: hinting,
-		})
-		smallFaces[i] = truetype.NewFace(f, &truetype.Options{
-			Size:    24,
-			Hinting: hinting,
-		})
+		pages = append(pages, page[:n])
+		page = page[n:]
 	}
+	renderPages(pages)
+	finishReport(args)
+}
 
-	cuts := []rune{
-		0x0080,
-		0x0100,
-		0x0143,
-		0x0200,
-		0x0400,
-		0x1000,
-		0x2500,
-		0xFFFF,
+// renderPages renders the pages concurrently, with up to -j workers, each
+// with its own faceSet. Each page's output is printed in page order.
+func renderPages(pages []repertoire.Set) {
+	outputs := make([]bytes.Buffer, len(pages))
+	done := make([]chan struct{}, len(pages))
+	for i := range done {
+		done[i] = make(chan struct{})
 	}
-	prevCut := rune(0)
-	for _, cut := range cuts {
-		do(prevCut, cut)
-		prevCut = cut
+
+	work := make(chan int)
+	for w := 0; w < *jobsFlag && w < len(pages); w++ {
+		fs := faces
+		if w > 0 {
+			fs = newFaceSet()
+		}
+		go func() {
+			for i := range work {
+				if *formatFlag == "svg" {
+					doSVG(fs, pages[i], &outputs[i])
+				} else if *waterfallFlag {
+					doWaterfall(fs, pages[i], &outputs[i])
+				} else {
+					do(fs, pages[i], &outputs[i])
+				}
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range pages {
+			work <- i
+		}
+		close(work)
+	}()
+
+	for i := range pages {
+		<-done[i]
+		os.Stdout.Write(outputs[i].Bytes())
 	}
 }
 
-func do(lo, hi rune) {
-	const yMax = 7168
+// loadRepertoire returns the repertoire given by the -text or -repertoire
+// flags.
+func loadRepertoire() repertoire.Set {
+	if *textFlag != "" {
+		return repertoire.OfText(*textFlag)
+	}
+	s, err := repertoire.Load(*repertoireFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return s
+}
 
-	dst := image.NewRGBA(image.Rect(0, 0, width*len(names)+384, yMax+smallHeight*(1+len(names))))
-	bounds := dst.Bounds()
-	draw.Draw(dst, bounds, image.White, image.Point{}, draw.Src)
+// loadVariants returns the combinations of the -sizes and -hinting flags.
+func loadVariants() []variant {
+	sizes := waterfallSizes
+	if !*waterfallFlag {
+		sizes = nil
+		for _, size := range strings.Split(*sizesFlag, ",") {
+			ppem, err := strconv.Atoi(strings.TrimSpace(size))
+			if err != nil || ppem <= 0 || ppem > 512 {
+				log.Fatalf("invalid -sizes %q", *sizesFlag)
+			}
+			sizes = append(sizes, ppem)
+		}
+	}
 
-	if *diffFlag {
-		dst0 := image.NewRGBA(image.Rect(0, 0, width*2, largeHeight*2))
-		dst1 := image.NewRGBA(image.Rect(0, 0, width*2, largeHeight*2))
-		d0 := &font.Drawer{
-			Dst: dst0,
-			Src: image.White,
+	// modes are the combinations of the -hinting and -render flags.
+	modes := []variant(nil)
+	for _, name := range strings.Split(*hintingFlag, ",") {
+		name = strings.TrimSpace(name)
+		h, ok := hintings[name]
+		if !ok {
+			log.Fatalf("unknown -hinting %q", name)
+		}
+		for _, render := range strings.Split(*renderFlag, ",") {
+			render = strings.TrimSpace(render)
+			if render != "aa" && render != "mono" {
+				log.Fatalf("unknown -render %q", render)
+			}
+			mode := name
+			if render == "mono" {
+				mode += "/mono"
+			}
+			modes = append(modes, variant{
+				hinting: h,
+				mono:    render == "mono",
+				mode:    mode,
+			})
 		}
-		d1 := &font.Drawer{
-			Dst: dst1,
-			Src: image.White,
+	}
+
+	ret := []variant(nil)
+	for _, ppem := range sizes {
+		for _, m := range modes {
+			m.ppem = ppem
+			m.label = fmt.Sprintf("%dpx/%s", ppem, m.mode)
+			ret = append(ret, m)
 		}
-		yellow := &image.Uniform{color.RGBA{0xff, 0xff, 0xcc, 0xff}}
+	}
+	return ret
+}
 
-		y := 64
-		for _, c := range repertoire {
-			if c < lo || hi <= c {
-				continue
-			}
+// column returns the faceSet.large index of the j'th source font's v'th
+// variant.
+func column(j, v int) int {
+	return j*len(variants) + v
+}
 
-			s := string(c)
-			for j := 0; j+1 < len(largeFaces); j += 2 {
-				for i := range dst0.Pix {
-					dst0.Pix[i] = 0
-				}
-				for i := range dst1.Pix {
-					dst1.Pix[i] = 0
+// footerHeight is the height of the list of source font names, and of the
+// variant labels if there is more than one variant, below the glyph rows.
+// -waterfall pages label each row instead.
+func footerHeight() int {
+	n := 1 + len(names)
+	if len(variants) > 1 && !*waterfallFlag {
+		n++
+	}
+	return smallHeight * n
+}
+
+// pageWidth is the width of a page: wide enough for the glyph columns and code
+// point labels, and for the footer.
+func pageWidth(fs *faceSet) int {
+	w := width*len(fs.large) + listLabelWidth
+	if *layoutFlag == "grid" {
+		w = tileWidth() * *columnsFlag
+	}
+	if fw := footerWidth(fs); w < fw {
+		w = fw
+	}
+	return w
+}
+
+// footerWidth is the width of the list of source font names, and of the
+// variant labels if footerHeight makes room for them.
+func footerWidth(fs *faceSet) int {
+	w := 0
+	for i := range names {
+		if n := 32 + font.MeasureString(fs.small[i], footerName(i)).Ceil(); w < n {
+			w = n
+		}
+	}
+	if len(variants) > 1 && !*waterfallFlag {
+		if n := 32 + font.MeasureString(fs.labelSmall, "Columns per font: "+variantLabels()).Ceil(); w < n {
+			w = n
+		}
+	}
+	return w
+}
+
+// pageHeight returns the height, in pixels, of n glyph rows, excluding the
+// footer. The first row's baseline is at y = largeHeight and the last row
+// needs room for its descenders.
+func pageHeight(n int) int {
+	if *waterfallFlag {
+		return smallHeight + waterfallGroupHeight()*n
+	}
+	if *layoutFlag == "grid" {
+		return tileHeight() * ((n + *columnsFlag - 1) / *columnsFlag)
+	}
+	return largeHeight * (n + 1)
+}
+
+// do prints one page, holding the given non-empty, sorted code points.
+func do(fs *faceSet, page repertoire.Set, stdout io.Writer) {
+	lo, hi := page[0], page[len(page)-1]+1
+	yMax := pageHeight(len(page))
+	grid := *layoutFlag == "grid"
+
+	dst := image.NewRGBA(image.Rect(0, 0, pageWidth(fs), yMax+footerHeight()))
+	bounds := dst.Bounds()
+	draw.Draw(dst, bounds, image.NewUniform(colors.background), image.Point{}, draw.Src)
+
+	if *diffFlag {
+		yellow := image.NewUniform(colors.diff)
+
+		ds := []glyphDiff(nil)
+		for i, c := range page {
+			for _, g := range diffPairs(fs, c) {
+				ds = append(ds, g)
+				if !g.exceeds() {
+					continue
 				}
-				d0.Face = largeFaces[j+0]
-				d1.Face = largeFaces[j+1]
-				d0.Dot = fixed.P((width*1)/2, (largeHeight*3)/2)
-				d1.Dot = fixed.P((width*1)/2, (largeHeight*3)/2)
-				d0.DrawString(s)
-				d1.DrawString(s)
-				if !bytes.Equal(dst0.Pix, dst1.Pix) {
-					draw.Draw(dst, image.Rect(
-						width*(j+0)+(width/8),
-						y-(1*largeHeight)+(largeHeight/8),
-						width*(j+2)+(width/8),
-						y-(0*largeHeight)+(largeHeight/8),
-					), yellow, image.Point{}, draw.Src)
+				for _, j := range [2]int{column(g.j0, g.v), column(g.j1, g.v)} {
+					draw.Draw(dst, cellRect(i, j), yellow, image.Point{}, draw.Src)
 				}
 			}
-			y += largeHeight
 		}
+		printDiffSummary(stdout, ds)
+		recordDiffs(ds)
+		writeOverlay(fs, page, ds, stdout)
 	}
 
-	for y := 0; y < yMax; y++ {
-		for j := range largeFaces {
-			dst.SetRGBA(width*j+16, y, color.RGBA{0xe0, 0xe0, 0xe0, 0xff})
+	if !grid {
+		for j := range fs.large {
+			x, _ := cellOrigin(0, j)
+			vLine(dst, x, 0, yMax-1, colors.rule)
 		}
 	}
 
-	gray := image.NewUniform(color.RGBA{0x80, 0x80, 0x80, 0xff})
+	pink := image.NewUniform(colors.missing)
+	metrics := []font.Metrics(nil)
+	if *metricsFlag {
+		metrics = columnMetrics(fs)
+	}
+
+	fg := image.NewUniform(colors.foreground)
+	gray := image.NewUniform(colors.label)
 	d := &font.Drawer{
 		Dst: dst,
 	}
-	y := 64
-	for _, c := range repertoire {
-		if c < lo || hi <= c {
-			continue
-		}
+	for i, c := range page {
+		x0, y := cellOrigin(i, 0)
+		if grid {
+			r := cellRect(i, len(fs.large)-1)
+			hLine(dst, x0-width/8, r.Max.X, y, colors.rule)
+			for j := range fs.large {
+				x, _ := cellOrigin(i, j)
+				vLine(dst, x, r.Min.Y, r.Max.Y, colors.rule)
+			}
 
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			dst.SetRGBA(x, y, color.RGBA{0xe0, 0xe0, 0xe0, 0xff})
+			d.Src = gray
+			d.Face = fs.labelTiny
+			d.Dot = fixed.P(x0, y+largeHeight/4+12)
+			d.DrawString(fmt.Sprintf("U+%04X", c))
+		} else {
+			hLine(dst, bounds.Min.X, bounds.Max.X-1, y, colors.rule)
+
+			d.Src = gray
+			d.Face = fs.labelTiny
+			d.Dot = fixed.P(width*len(fs.large)+64, y+12)
+			d.DrawString(runenames.Name(rune(c)))
+
+			d.Src = fg
+			d.Face = fs.labelSmall
+			d.Dot = fixed.P(width*len(fs.large)+64, y)
+			d.DrawString(fmt.Sprintf("U+%04X", c))
 		}
 
-		d.Src = gray
-		d.Face = goregularTinyFace
-		d.Dot = fixed.P(width*len(names)+64, y+12)
-		d.DrawString(runenames.Name(rune(c)))
-
-		d.Src = image.Black
-		d.Face = goregularSmallFace
-		d.Dot = fixed.P(width*len(names)+64, y)
-		d.DrawString(fmt.Sprintf("U+%04X", c))
-
 		s := string(c)
-		for j, face := range largeFaces {
+		d.Src = fg
+		for j, face := range fs.large {
+			x, _ := cellOrigin(i, j)
+			if isMissing(j, c) {
+				draw.Draw(dst, cellRect(i, j), pink, image.Point{}, draw.Src)
+				d.Face = fs.labelTiny
+				d.Dot = fixed.P(x, y-largeHeight/2)
+				d.DrawString("missing")
+				continue
+			}
+			if *metricsFlag {
+				drawMetrics(dst, face, metrics[j], c, x, y)
+			}
 			d.Face = face
-			d.Dot = fixed.P(width*j+16, y)
+			d.Dot = fixed.P(x, y)
 			d.DrawString(s)
 		}
-		y += largeHeight
 	}
 
-	for i, s := range names {
-		d.Face = smallFaces[i]
+	for i := range names {
+		d.Face = fs.small[i]
 		d.Dot = fixed.P(16, yMax+(i+1)*smallHeight)
-		d.DrawString(s)
+		d.DrawString(footerName(i))
+	}
+	if len(variants) > 1 {
+		d.Src = gray
+		d.Face = fs.labelSmall
+		d.Dot = fixed.P(16, yMax+(len(names)+1)*smallHeight)
+		d.DrawString("Columns per font: " + variantLabels())
 	}
 
-	filename := fmt.Sprintf("side-by-side-%04x-%04x.png", lo, hi)
+	filename := outputFilename(lo, hi, ".png")
 	outFile, err := os.Create(filename)
 	if err != nil {
 		log.Fatal(err)
@@ -222,121 +656,158 @@ func do(lo, hi rune) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Printf("Wrote %s\n", filename)
+	fmt.Fprintf(stdout, "Wrote %s\n", filename)
 }
 
-// repertoire is the WGL-4 repertoire plus:
-//	- Pinyin diacritic-vowel combinations, U+01CD ..= U+01DC.
-//	- U+037E GREEK QUESTION MARK
-//	- Superscripts and subscripts: U+2070, U+2074 ..= U+207E, U+2080 ..= U+208E, U+2099.
-//	- U+222A UNION
-//	- U+F800 <Private Use>
-//	- U+FFFD REPLACEMENT CHARACTER
-var repertoire = []rune{
-	// 0x0000 .. 0x0080
-	'\u0021', '\u0022', '\u0023', '\u0024', '\u0025', '\u0026', '\u0027', '\u0028',
-	'\u0029', '\u002a', '\u002b', '\u002c', '\u002d', '\u002e', '\u002f', '\u0030',
-	'\u0031', '\u0032', '\u0033', '\u0034', '\u0035', '\u0036', '\u0037', '\u0038',
-	'\u0039', '\u003a', '\u003b', '\u003c', '\u003d', '\u003e', '\u003f', '\u0040',
-	'\u0041', '\u0042', '\u0043', '\u0044', '\u0045', '\u0046', '\u0047', '\u0048',
-	'\u0049', '\u004a', '\u004b', '\u004c', '\u004d', '\u004e', '\u004f', '\u0050',
-	'\u0051', '\u0052', '\u0053', '\u0054', '\u0055', '\u0056', '\u0057', '\u0058',
-	'\u0059', '\u005a', '\u005b', '\u005c', '\u005d', '\u005e', '\u005f', '\u0060',
-	'\u0061', '\u0062', '\u0063', '\u0064', '\u0065', '\u0066', '\u0067', '\u0068',
-	'\u0069', '\u006a', '\u006b', '\u006c', '\u006d', '\u006e', '\u006f', '\u0070',
-	'\u0071', '\u0072', '\u0073', '\u0074', '\u0075', '\u0076', '\u0077', '\u0078',
-	'\u0079', '\u007a', '\u007b', '\u007c', '\u007d', '\u007e',
-
-	// 0x0080 .. 0x0100
-	'\u00a1', '\u00a2', '\u00a3', '\u00a4', '\u00a5', '\u00a6', '\u00a7', '\u00a8',
-	'\u00a9', '\u00aa', '\u00ab', '\u00ac', '\u00ae', '\u00af', '\u00b0', '\u00b1',
-	'\u00b2', '\u00b3', '\u00b4', '\u00b5', '\u00b6', '\u00b7', '\u00b8', '\u00b9',
-	'\u00ba', '\u00bb', '\u00bc', '\u00bd', '\u00be', '\u00bf', '\u00c0', '\u00c1',
-	'\u00c2', '\u00c3', '\u00c4', '\u00c5', '\u00c6', '\u00c7', '\u00c8', '\u00c9',
-	'\u00ca', '\u00cb', '\u00cc', '\u00cd', '\u00ce', '\u00cf', '\u00d0', '\u00d1',
-	'\u00d2', '\u00d3', '\u00d4', '\u00d5', '\u00d6', '\u00d7', '\u00d8', '\u00d9',
-	'\u00da', '\u00db', '\u00dc', '\u00dd', '\u00de', '\u00df', '\u00e0', '\u00e1',
-	'\u00e2', '\u00e3', '\u00e4', '\u00e5', '\u00e6', '\u00e7', '\u00e8', '\u00e9',
-	'\u00ea', '\u00eb', '\u00ec', '\u00ed', '\u00ee', '\u00ef', '\u00f0', '\u00f1',
-	'\u00f2', '\u00f3', '\u00f4', '\u00f5', '\u00f6', '\u00f7', '\u00f8', '\u00f9',
-	'\u00fa', '\u00fb', '\u00fc', '\u00fd', '\u00fe', '\u00ff',
-
-	// 0x0100 .. 0x0143
-	'\u0100', '\u0101', '\u0102', '\u0103', '\u0104', '\u0105', '\u0106', '\u0107',
-	'\u0108', '\u0109', '\u010a', '\u010b', '\u010c', '\u010d', '\u010e', '\u010f',
-	'\u0110', '\u0111', '\u0112', '\u0113', '\u0114', '\u0115', '\u0116', '\u0117',
-	'\u0118', '\u0119', '\u011a', '\u011b', '\u011c', '\u011d', '\u011e', '\u011f',
-	'\u0120', '\u0121', '\u0122', '\u0123', '\u0124', '\u0125', '\u0126', '\u0127',
-	'\u0128', '\u0129', '\u012a', '\u012b', '\u012c', '\u012d', '\u012e', '\u012f',
-	'\u0130', '\u0131', '\u0132', '\u0133', '\u0134', '\u0135', '\u0136', '\u0137',
-	'\u0138', '\u0139', '\u013a', '\u013b', '\u013c', '\u013d', '\u013e', '\u013f',
-	'\u0140', '\u0141', '\u0142', '\u0143',
-
-	// 0x0143 .. 0x0200
-	'\u0144', '\u0145', '\u0146', '\u0147', '\u0148', '\u0149', '\u014a', '\u014b',
-	'\u014c', '\u014d', '\u014e', '\u014f', '\u0150', '\u0151', '\u0152', '\u0153',
-	'\u0154', '\u0155', '\u0156', '\u0157', '\u0158', '\u0159', '\u015a', '\u015b',
-	'\u015c', '\u015d', '\u015e', '\u015f', '\u0160', '\u0161', '\u0162', '\u0163',
-	'\u0164', '\u0165', '\u0166', '\u0167', '\u0168', '\u0169', '\u016a', '\u016b',
-	'\u016c', '\u016d', '\u016e', '\u016f', '\u0170', '\u0171', '\u0172', '\u0173',
-	'\u0174', '\u0175', '\u0176', '\u0177', '\u0178', '\u0179', '\u017a', '\u017b',
-	'\u017c', '\u017d', '\u017e', '\u017f', '\u0192', '\u01cd', '\u01ce', '\u01cf',
-	'\u01d0', '\u01d1', '\u01d2', '\u01d3', '\u01d4', '\u01d5', '\u01d6', '\u01d7',
-	'\u01d8', '\u01d9', '\u01da', '\u01db', '\u01dc', '\u01fa', '\u01fb', '\u01fc',
-	'\u01fd', '\u01fe', '\u01ff',
-
-	// 0x0200 .. 0x0400
-	'\u02c6', '\u02c7', '\u02c9', '\u02d8', '\u02d9', '\u02da', '\u02db', '\u02dc',
-	'\u02dd', '\u037e', '\u0384', '\u0385', '\u0386', '\u0387', '\u0388', '\u0389',
-	'\u038a', '\u038c', '\u038e', '\u038f', '\u0390', '\u0391', '\u0392', '\u0393',
-	'\u0394', '\u0395', '\u0396', '\u0397', '\u0398', '\u0399', '\u039a', '\u039b',
-	'\u039c', '\u039d', '\u039e', '\u039f', '\u03a0', '\u03a1', '\u03a3', '\u03a4',
-	'\u03a5', '\u03a6', '\u03a7', '\u03a8', '\u03a9', '\u03aa', '\u03ab', '\u03ac',
-	'\u03ad', '\u03ae', '\u03af', '\u03b0', '\u03b1', '\u03b2', '\u03b3', '\u03b4',
-	'\u03b5', '\u03b6', '\u03b7', '\u03b8', '\u03b9', '\u03ba', '\u03bb', '\u03bc',
-	'\u03bd', '\u03be', '\u03bf', '\u03c0', '\u03c1', '\u03c2', '\u03c3', '\u03c4',
-	'\u03c5', '\u03c6', '\u03c7', '\u03c8', '\u03c9', '\u03ca', '\u03cb', '\u03cc',
-	'\u03cd', '\u03ce',
-
-	// 0x0400 .. 0x1000
-	'\u0400', '\u0401', '\u0402', '\u0403', '\u0404', '\u0405', '\u0406', '\u0407',
-	'\u0408', '\u0409', '\u040a', '\u040b', '\u040c', '\u040d', '\u040e', '\u040f',
-	'\u0410', '\u0411', '\u0412', '\u0413', '\u0414', '\u0415', '\u0416', '\u0417',
-	'\u0418', '\u0419', '\u041a', '\u041b', '\u041c', '\u041d', '\u041e', '\u041f',
-	'\u0420', '\u0421', '\u0422', '\u0423', '\u0424', '\u0425', '\u0426', '\u0427',
-	'\u0428', '\u0429', '\u042a', '\u042b', '\u042c', '\u042d', '\u042e', '\u042f',
-	'\u0430', '\u0431', '\u0432', '\u0433', '\u0434', '\u0435', '\u0436', '\u0437',
-	'\u0438', '\u0439', '\u043a', '\u043b', '\u043c', '\u043d', '\u043e', '\u043f',
-	'\u0440', '\u0441', '\u0442', '\u0443', '\u0444', '\u0445', '\u0446', '\u0447',
-	'\u0448', '\u0449', '\u044a', '\u044b', '\u044c', '\u044d', '\u044e', '\u044f',
-	'\u0450', '\u0451', '\u0452', '\u0453', '\u0454', '\u0455', '\u0456', '\u0457',
-	'\u0458', '\u0459', '\u045a', '\u045b', '\u045c', '\u045d', '\u045e', '\u045f',
-	'\u0490', '\u0491',
-
-	// 0x1000 .. 0x2500
-	'\u1e80', '\u1e81', '\u1e82', '\u1e83', '\u1e84', '\u1e85', '\u1ef2', '\u1ef3',
-	'\u2013', '\u2014', '\u2015', '\u2017', '\u2018', '\u2019', '\u201a', '\u201b',
-	'\u201c', '\u201d', '\u201e', '\u2020', '\u2021', '\u2022', '\u2026', '\u2030',
-	'\u2032', '\u2033', '\u2039', '\u203a', '\u203c', '\u203e', '\u2044', '\u2070',
-	'\u2074', '\u2075', '\u2076', '\u2077', '\u2078', '\u2079', '\u207a', '\u207b',
-	'\u207c', '\u207d', '\u207e', '\u207f', '\u2080', '\u2081', '\u2082', '\u2083',
-	'\u2084', '\u2085', '\u2086', '\u2087', '\u2088', '\u2089', '\u208a', '\u208b',
-	'\u208c', '\u208d', '\u208e', '\u2099', '\u20a3', '\u20a4', '\u20a7', '\u20ac',
-	'\u2105', '\u2113', '\u2116', '\u2122', '\u212e', '\u215b', '\u215c', '\u215d',
-	'\u215e', '\u2190', '\u2191', '\u2192', '\u2193', '\u2194', '\u2195', '\u21a8',
-	'\u2202', '\u2206', '\u220f', '\u2211', '\u2212', '\u2215', '\u2219', '\u221a',
-	'\u221e', '\u221f', '\u2229', '\u222a', '\u222b', '\u2248', '\u2260', '\u2261',
-	'\u2264', '\u2265', '\u2302', '\u2310', '\u2320', '\u2321',
-
-	// 0x2500 .. 0xFFFF
-	'\u2500', '\u2502', '\u250c', '\u2510', '\u2514', '\u2518', '\u251c', '\u2524',
-	'\u252c', '\u2534', '\u253c', '\u2550', '\u2551', '\u2552', '\u2553', '\u2554',
-	'\u2555', '\u2556', '\u2557', '\u2558', '\u2559', '\u255a', '\u255b', '\u255c',
-	'\u255d', '\u255e', '\u255f', '\u2560', '\u2561', '\u2562', '\u2563', '\u2564',
-	'\u2565', '\u2566', '\u2567', '\u2568', '\u2569', '\u256a', '\u256b', '\u256c',
-	'\u2580', '\u2584', '\u2588', '\u258c', '\u2590', '\u2591', '\u2592', '\u2593',
-	'\u25a0', '\u25a1', '\u25aa', '\u25ab', '\u25ac', '\u25b2', '\u25ba', '\u25bc',
-	'\u25c4', '\u25ca', '\u25cb', '\u25cf', '\u25d8', '\u25d9', '\u25e6', '\u263a',
-	'\u263b', '\u263c', '\u2640', '\u2642', '\u2660', '\u2663', '\u2665', '\u2666',
-	'\u266a', '\u266b', '\uf800', '\ufb01', '\ufb02', '\ufffd',
+// rasterize draws s, in white, with its dot (its origin) at (width/2,
+// largeHeight*3/2) of a new (width*2) × (largeHeight*2) image. Glyphs for a
+// single rune should fit within that image.
+func rasterize(face font.Face, s string) *image.Alpha {
+	dst := image.NewAlpha(image.Rect(0, 0, width*2, largeHeight*2))
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.White,
+		Face: face,
+		Dot:  fixed.P((width*1)/2, (largeHeight*3)/2),
+	}
+	d.DrawString(s)
+	return dst
+}
+
+// faceSet is a set of faces for drawing pages. Faces are not safe for
+// concurrent use, so each goroutine that draws needs its own faceSet.
+type faceSet struct {
+	// large has one face per column: len(variants) for each of the source
+	// fonts. The j'th source font's v'th variant is at column(j, v).
+	large []font.Face
+	// small has one face per source font, for the footer. It is the
+	// labelSmall face if the source font cannot draw its own name.
+	small []font.Face
+
+	// labelSmall and labelTiny are -labelfont faces.
+	labelSmall font.Face
+	labelTiny  font.Face
+}
+
+func newFaceSet() *faceSet {
+	fs := &faceSet{
+		large:      make([]font.Face, len(names)*len(variants)),
+		small:      make([]font.Face, len(names)),
+		labelSmall: newFace(labelTTFont, labelSFNTFont, smallPPEM, font.HintingNone),
+		labelTiny:  newFace(labelTTFont, labelSFNTFont, 10, font.HintingNone),
+	}
+	for i := range names {
+		for v, va := range variants {
+			fs.large[column(i, v)] = newFace(ttFonts[i], sfntFonts[i], va.ppem, va.hinting)
+			if va.mono {
+				fs.large[column(i, v)] = monoFace{fs.large[column(i, v)]}
+			}
+		}
+		fs.small[i] = fs.labelSmall
+		if covers(sfntFonts[i], footerName(i)) {
+			fs.small[i] = newFace(ttFonts[i], sfntFonts[i], smallPPEM, font.HintingNone)
+		}
+	}
+	return fs
+}
+
+// newFace returns a face for tf if it is non-nil, or for sf otherwise.
+func newFace(tf *truetype.Font, sf *sfnt.Font, ppem int, hinting font.Hinting) font.Face {
+	if tf != nil {
+		return truetype.NewFace(tf, &truetype.Options{
+			Size:    float64(ppem),
+			Hinting: hinting,
+		})
+	}
+	face, err := opentype.NewFace(sf, &opentype.FaceOptions{
+		Size:    float64(ppem),
+		DPI:     72,
+		Hinting: hinting,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return face
+}
+
+// fontName returns f's full name and version, such as "Go Regular; Version
+// 2.008; ttfautohint (v1.6)".
+func fontName(f *sfnt.Font) string {
+	var buf sfnt.Buffer
+	full, _ := f.Name(&buf, sfnt.NameIDFull)
+	version, _ := f.Name(&buf, sfnt.NameIDVersion)
+	return fmt.Sprintf("%s; %s", full, version)
+}
+
+// missingChars returns those chars that f's cmap lacks.
+func missingChars(f *sfnt.Font) repertoire.Set {
+	var buf sfnt.Buffer
+	ret := repertoire.Set(nil)
+	for _, c := range chars {
+		x, err := f.GlyphIndex(&buf, c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if x == 0 {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// covers returns whether f's cmap has every rune of s, other than spaces.
+func covers(f *sfnt.Font, s string) bool {
+	var buf sfnt.Buffer
+	for _, c := range s {
+		if c == ' ' {
+			continue
+		}
+		if x, err := f.GlyphIndex(&buf, c); err != nil || x == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isMissing returns whether the source font of the j'th column lacks c.
+func isMissing(j int, c rune) bool {
+	return missing[j/len(variants)].Contains(c)
+}
+
+// footerName returns the i'th source font's name and how many of the
+// repertoire it lacks.
+func footerName(i int) string {
+	return fmt.Sprintf("%s (missing %d of %d)", names[i], len(missing[i]), len(chars))
+}
+
+// variantLabels returns the variants' labels, such as "48px/none, 24px/none".
+func variantLabels() string {
+	labels := make([]string, len(variants))
+	for i, v := range variants {
+		labels[i] = v.label
+	}
+	return strings.Join(labels, ", ")
+}
+
+// outputFilename returns the -out and -name based filename for the [lo, hi)
+// page, creating any parent directories.
+func outputFilename(lo, hi rune, ext string) string {
+	return namedFilename(fmt.Sprintf("%04x", lo), fmt.Sprintf("%04x", hi), ext)
+}
+
+// namedFilename is like outputFilename, but with .Lo and .Hi given as is,
+// instead of as code points.
+func namedFilename(lo, hi string, ext string) string {
+	data := nameData
+	data.Lo = lo
+	data.Hi = hi
+	b := &strings.Builder{}
+	if err := nameTemplate.Execute(b, &data); err != nil {
+		log.Fatal(err)
+	}
+	filename := filepath.Join(*outFlag, b.String()+ext)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		log.Fatal(err)
+	}
+	return filename
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"log"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	ascentColor    = color.RGBA{0x80, 0xc0, 0xff, 0xff}
+	capHeightColor = color.RGBA{0xff, 0x80, 0x80, 0xff}
+	xHeightColor   = color.RGBA{0x80, 0xd0, 0x80, 0xff}
+	baselineColor  = color.RGBA{0x80, 0x80, 0x80, 0xff}
+	advanceColor   = color.RGBA{0xff, 0xb0, 0x40, 0xff}
+	boundsColor    = color.RGBA{0xe0, 0x80, 0xe0, 0xff}
+)
+
+// columnMetrics returns the metrics of each column's face. The truetype
+// package's faces do not report the x-height or cap-height, so those come
+// from the sfnt package instead.
+func columnMetrics(fs *faceSet) []font.Metrics {
+	var buf sfnt.Buffer
+	ret := make([]font.Metrics, len(fs.large))
+	for j, face := range fs.large {
+		ret[j] = face.Metrics()
+		if ret[j].XHeight != 0 && ret[j].CapHeight != 0 {
+			continue
+		}
+		va := variants[j%len(variants)]
+		m, err := sfntFonts[j/len(variants)].Metrics(&buf, fixed.I(va.ppem), va.hinting)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ret[j].XHeight = m.XHeight
+		ret[j].CapHeight = m.CapHeight
+	}
+	return ret
+}
+
+// drawMetrics draws, behind where the glyph for c will be drawn with its
+// origin at (x, y), lines for the face's ascent and descent (blue), cap-height
+// (red), x-height (green) and baseline (grey), and for the glyph's advance
+// width (orange) and bounding box (magenta).
+func drawMetrics(dst *image.RGBA, face font.Face, m font.Metrics, c rune, x, y int) {
+	x0, x1 := x-width/8, x+width-width/8
+	hLine(dst, x0, x1, y-m.Ascent.Round(), ascentColor)
+	hLine(dst, x0, x1, y+m.Descent.Round(), ascentColor)
+	hLine(dst, x0, x1, y-m.CapHeight.Round(), capHeightColor)
+	hLine(dst, x0, x1, y-m.XHeight.Round(), xHeightColor)
+	hLine(dst, x0, x1, y, baselineColor)
+
+	bounds, advance, ok := face.GlyphBounds(c)
+	if !ok {
+		return
+	}
+	vLine(dst, x+advance.Round(), y-m.Ascent.Round(), y+m.Descent.Round(), advanceColor)
+	if bounds.Empty() {
+		return
+	}
+	bx0, by0 := x+bounds.Min.X.Floor(), y+bounds.Min.Y.Floor()
+	bx1, by1 := x+bounds.Max.X.Ceil(), y+bounds.Max.Y.Ceil()
+	hLine(dst, bx0, bx1, by0, boundsColor)
+	hLine(dst, bx0, bx1, by1, boundsColor)
+	vLine(dst, bx0, by0, by1, boundsColor)
+	vLine(dst, bx1, by0, by1, boundsColor)
+}
+
+func hLine(dst *image.RGBA, x0, x1, y int, c color.RGBA) {
+	for x := x0; x <= x1; x++ {
+		dst.SetRGBA(x, y, c)
+	}
+}
+
+func vLine(dst *image.RGBA, x, y0, y1 int, c color.RGBA) {
+	for y := y0; y <= y1; y++ {
+		dst.SetRGBA(x, y, c)
+	}
+}
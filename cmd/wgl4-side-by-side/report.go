@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/nigeltao/fontscripts/repertoire"
+
+	"golang.org/x/text/unicode/runenames"
+)
+
+// reportFont is a source font in the -report JSON file.
+type reportFont struct {
+	File string `json:"file"`
+	Name string `json:"name"`
+}
+
+// reportGlyph is a glyphDiff in the -report JSON file. Differs is whether it
+// exceeds the -tolerance, and Allowed is whether the -allow file lists it.
+type reportGlyph struct {
+	CodePoint string  `json:"codePoint"`
+	Name      string  `json:"name"`
+	Fonts     [2]int  `json:"fonts"`
+	Variant   string  `json:"variant"`
+	Differs   bool    `json:"differs"`
+	Allowed   bool    `json:"allowed"`
+	Changed   int     `json:"changed"`
+	MaxDelta  int     `json:"maxDelta"`
+	IoU       float64 `json:"iou"`
+
+	c rune
+	k int
+}
+
+// report is the -report JSON file. Unexpected counts the Glyphs that differ
+// but are not allowed.
+type report struct {
+	Fonts      []reportFont  `json:"fonts"`
+	Tolerance  int           `json:"tolerance"`
+	Unexpected int           `json:"unexpected"`
+	Glyphs     []reportGlyph `json:"glyphs"`
+}
+
+var (
+	// allowed is the -allow file's code points: those that may differ.
+	allowed repertoire.Set
+
+	// reportMu guards reportGlyphs, which the page workers append to.
+	reportMu     sync.Mutex
+	reportGlyphs []reportGlyph
+)
+
+// loadAllowed returns the code points of the -allow repertoire, which is given
+// the same way as the -repertoire flag.
+func loadAllowed() repertoire.Set {
+	if *allowFlag == "" {
+		return nil
+	}
+	s, err := repertoire.Load(*allowFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return s
+}
+
+// recordDiffs adds the glyphDiffs, whether or not they exceed the
+// -tolerance, to the -report.
+func recordDiffs(ds []glyphDiff) {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+	for _, d := range ds {
+		reportGlyphs = append(reportGlyphs, reportGlyph{
+			CodePoint: fmt.Sprintf("U+%04X", d.c),
+			Name:      runenames.Name(d.c),
+			Fonts:     [2]int{d.j0, d.j1},
+			Variant:   variants[d.v].label,
+			Differs:   d.exceeds(),
+			Allowed:   allowed.Contains(d.c),
+			Changed:   d.Changed,
+			MaxDelta:  d.MaxDelta,
+			IoU:       d.IoU,
+			c:         d.c,
+			k:         d.k,
+		})
+	}
+}
+
+// finishReport writes the -report file, if any, once every page is done. With
+// -allow, it then exits with a non-zero status if any glyph differs that the
+// -allow file does not list.
+func finishReport(args []string) {
+	r := report{
+		Fonts:     make([]reportFont, len(args)),
+		Tolerance: *toleranceFlag,
+		Glyphs:    reportGlyphs,
+	}
+	for i, arg := range args {
+		r.Fonts[i] = reportFont{File: arg, Name: names[i]}
+	}
+	if r.Glyphs == nil {
+		r.Glyphs = []reportGlyph{}
+	}
+	sort.Slice(r.Glyphs, func(i, j int) bool {
+		if r.Glyphs[i].c != r.Glyphs[j].c {
+			return r.Glyphs[i].c < r.Glyphs[j].c
+		}
+		return r.Glyphs[i].k < r.Glyphs[j].k
+	})
+	for _, g := range r.Glyphs {
+		if g.Differs && !g.Allowed {
+			r.Unexpected++
+		}
+	}
+
+	if *reportFlag != "" {
+		b, err := json.MarshalIndent(r, "", "\t")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = ioutil.WriteFile(*reportFlag, append(b, '\n'), 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Wrote %s\n", *reportFlag)
+	}
+	if *allowFlag != "" && r.Unexpected > 0 {
+		log.Fatalf("%d unexpected glyph differences: not listed in %s", r.Unexpected, *allowFlag)
+	}
+}
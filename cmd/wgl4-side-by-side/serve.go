@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/nigeltao/fontscripts/fontfile"
+	"github.com/nigeltao/fontscripts/repertoire"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/unicode/runenames"
+)
+
+// maxServeGlyphs is the most glyphs that one served page shows.
+const maxServeGlyphs = 1024
+
+// maxZoom is the largest zoom of a served glyph raster. At the largest size,
+// such a raster is then at most 5472 by 4104 pixels.
+const maxZoom = 8
+
+// serveFonts is a snapshot of the source fonts. It is replaced, not modified,
+// when the source font files change.
+type serveFonts struct {
+	generation int
+	modTimes   []time.Time
+	names      []string
+	ttFonts    []*truetype.Font
+	sfntFonts  []*sfnt.Font
+	missing    []repertoire.Set
+}
+
+var (
+	serveMu      sync.Mutex
+	serveArgs    []string
+	serveCurrent *serveFonts
+)
+
+// serve runs the -serve HTTP server. It never returns.
+func serve(args []string) {
+	serveArgs = args
+	serveCurrent = &serveFonts{
+		modTimes:  modTimes(args),
+		names:     names,
+		ttFonts:   ttFonts,
+		sfntFonts: sfntFonts,
+		missing:   missing,
+	}
+	http.HandleFunc("/", serveIndex)
+	http.HandleFunc("/glyph.png", serveGlyph)
+	fmt.Printf("Serving on %s\n", *serveFlag)
+	log.Fatal(http.ListenAndServe(*serveFlag, nil))
+}
+
+// modTimes returns when each source font file was last modified, or the zero
+// time if it cannot be read.
+func modTimes(args []string) []time.Time {
+	ret := make([]time.Time, len(args))
+	for i, arg := range args {
+		filename, _ := fontfile.SplitArg(arg)
+		if fi, err := os.Stat(filename); err == nil {
+			ret[i] = fi.ModTime()
+		}
+	}
+	return ret
+}
+
+// currentFonts returns the source fonts, re-reading them if any of their
+// files have changed since they were last read.
+func currentFonts() (*serveFonts, error) {
+	serveMu.Lock()
+	defer serveMu.Unlock()
+
+	times := modTimes(serveArgs)
+	changed := false
+	for i, t := range times {
+		changed = changed || !t.Equal(serveCurrent.modTimes[i])
+	}
+	if !changed {
+		return serveCurrent, nil
+	}
+
+	n := len(serveArgs)
+	sf := &serveFonts{
+		generation: serveCurrent.generation + 1,
+		modTimes:   times,
+		names:      make([]string, n),
+		ttFonts:    make([]*truetype.Font, n),
+		sfntFonts:  make([]*sfnt.Font, n),
+		missing:    make([]repertoire.Set, n),
+	}
+	for i, arg := range serveArgs {
+		var err error
+		sf.ttFonts[i], sf.sfntFonts[i], err = parseFont(arg)
+		if err != nil {
+			return nil, err
+		}
+		sf.names[i] = fontName(sf.sfntFonts[i])
+		sf.missing[i] = missingChars(sf.sfntFonts[i])
+	}
+	serveCurrent = sf
+	log.Printf("re-read %d source fonts", n)
+	return sf, nil
+}
+
+// serveParams are the browser's choices, from the URL query.
+type serveParams struct {
+	fonts   []int
+	size    int
+	hinting string
+	render  string
+	lo, hi  rune
+	diff    bool
+}
+
+func parseServeParams(q url.Values, numFonts int) (serveParams, error) {
+	p := serveParams{
+		size:    48,
+		hinting: "none",
+		render:  "aa",
+		lo:      chars[0],
+		hi:      chars[len(chars)-1] + 1,
+		diff:    q.Get("diff") != "",
+	}
+	if len(chars) > 128 {
+		p.hi = chars[128]
+	}
+
+	for _, s := range q["f"] {
+		j, err := strconv.Atoi(s)
+		if err != nil || j < 0 || numFonts <= j {
+			return p, fmt.Errorf("invalid font index %q", s)
+		}
+		p.fonts = append(p.fonts, j)
+	}
+	if len(p.fonts) == 0 {
+		for j := 0; j < numFonts; j++ {
+			p.fonts = append(p.fonts, j)
+		}
+	}
+
+	if s := q.Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 6 || 256 < n {
+			return p, fmt.Errorf("invalid size %q", s)
+		}
+		p.size = n
+	}
+	if s := q.Get("hinting"); s != "" {
+		if _, ok := hintings[s]; !ok {
+			return p, fmt.Errorf("invalid hinting %q", s)
+		}
+		p.hinting = s
+	}
+	if s := q.Get("render"); s != "" {
+		if s != "aa" && s != "mono" {
+			return p, fmt.Errorf("invalid render %q", s)
+		}
+		p.render = s
+	}
+	for _, x := range []struct {
+		key string
+		dst *rune
+	}{{"lo", &p.lo}, {"hi", &p.hi}} {
+		if s := q.Get(x.key); s != "" {
+			n, err := strconv.ParseUint(s, 16, 32)
+			if err != nil || unicode.MaxRune+1 < n {
+				return p, fmt.Errorf("invalid %s %q", x.key, s)
+			}
+			*x.dst = rune(n)
+		}
+	}
+	if p.lo > p.hi {
+		return p, fmt.Errorf("invalid range: lo %X is above hi %X", p.lo, p.hi)
+	}
+	return p, nil
+}
+
+// glyphURL returns the URL of the j'th font's raster of c.
+func (p serveParams) glyphURL(generation, j int, c rune, zoom int) template.URL {
+	q := url.Values{}
+	q.Set("v", strconv.Itoa(generation))
+	q.Set("f", strconv.Itoa(j))
+	q.Set("size", strconv.Itoa(p.size))
+	q.Set("hinting", p.hinting)
+	q.Set("render", p.render)
+	q.Set("c", fmt.Sprintf("%X", c))
+	q.Set("zoom", strconv.Itoa(zoom))
+	return template.URL("/glyph.png?" + q.Encode())
+}
+
+// face returns a new face for the j'th font.
+func (p serveParams) face(sf *serveFonts, j int) font.Face {
+	face := newFace(sf.ttFonts[j], sf.sfntFonts[j], p.size, hintings[p.hinting])
+	if p.render == "mono" {
+		face = monoFace{face}
+	}
+	return face
+}
+
+type serveFont struct {
+	Index    int
+	Name     string
+	Selected bool
+}
+
+type serveRow struct {
+	Code  string
+	Name  string
+	Cells []serveCell
+}
+
+type serveCell struct {
+	Src     template.URL
+	Zoom    template.URL
+	Diff    bool
+	Missing bool
+}
+
+func serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	sf, err := currentFonts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p, err := parseServeParams(r.URL.Query(), len(sf.names))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := chars.Within(p.lo, p.hi)
+	truncated := len(page) > maxServeGlyphs
+	if truncated {
+		page = page[:maxServeGlyphs]
+	}
+
+	fonts := make([]serveFont, len(sf.names))
+	for j, name := range sf.names {
+		fonts[j] = serveFont{Index: j, Name: name}
+	}
+	faces := make([]font.Face, len(p.fonts))
+	for k, j := range p.fonts {
+		fonts[j].Selected = true
+		faces[k] = p.face(sf, j)
+	}
+
+	rows := make([]serveRow, len(page))
+	for i, c := range page {
+		row := serveRow{
+			Code:  fmt.Sprintf("U+%04X", c),
+			Name:  runenames.Name(c),
+			Cells: make([]serveCell, len(p.fonts)),
+		}
+		ref := (*image.Alpha)(nil)
+		for k, j := range p.fonts {
+			cell := &row.Cells[k]
+			if sf.missing[j].Contains(c) {
+				cell.Missing = true
+				continue
+			}
+			cell.Src = p.glyphURL(sf.generation, j, c, 1)
+			cell.Zoom = p.glyphURL(sf.generation, j, c, maxZoom)
+			if !p.diff {
+				continue
+			}
+			// The reference is the first selected font that has the glyph.
+			a := serveRaster(faces[k], c, p.size)
+			if ref == nil {
+				ref = a
+			} else if ref != nil {
+				cell.Diff = compare(ref, a).exceeds()
+			}
+		}
+		rows[i] = row
+	}
+
+	buf := &bytes.Buffer{}
+	err = serveTemplate.Execute(buf, struct {
+		Fonts     []serveFont
+		Size      int
+		Hinting   string
+		Hintings  []string
+		Render    string
+		Lo, Hi    string
+		Diff      bool
+		Rows      []serveRow
+		Truncated bool
+		Max       int
+	}{
+		Fonts:     fonts,
+		Size:      p.size,
+		Hinting:   p.hinting,
+		Hintings:  []string{"none", "vertical", "full"},
+		Render:    p.render,
+		Lo:        fmt.Sprintf("%04X", p.lo),
+		Hi:        fmt.Sprintf("%04X", p.hi),
+		Diff:      p.diff,
+		Rows:      rows,
+		Truncated: truncated,
+		Max:       maxServeGlyphs,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func serveGlyph(w http.ResponseWriter, r *http.Request) {
+	sf, err := currentFonts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	p, err := parseServeParams(q, len(sf.names))
+	if err != nil || len(q["f"]) != 1 {
+		http.Error(w, "invalid glyph request", http.StatusBadRequest)
+		return
+	}
+	c, err := strconv.ParseUint(q.Get("c"), 16, 32)
+	if err != nil || c > unicode.MaxRune {
+		http.Error(w, "invalid code point", http.StatusBadRequest)
+		return
+	}
+	zoom, err := strconv.Atoi(q.Get("zoom"))
+	if err != nil || zoom < 1 || maxZoom < zoom {
+		zoom = 1
+	}
+
+	j := p.fonts[0]
+	mask := serveRaster(p.face(sf, j), rune(c), p.size)
+	b := mask.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, b.Dx()*zoom, b.Dy()*zoom))
+	for y := 0; y < b.Dy()*zoom; y++ {
+		for x := 0; x < b.Dx()*zoom; x++ {
+			dst.SetGray(x, y, color.Gray{0xff - mask.AlphaAt(x/zoom, y/zoom).A})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, dst); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
+
+// serveRaster draws c, in white, in a new image proportioned like the bottom
+// three quarters of a rasterize image, but scaled to ppem.
+func serveRaster(face font.Face, c rune, ppem int) *image.Alpha {
+	cell := (ppem*4 + 2) / 3
+	dst := image.NewAlpha(image.Rect(0, 0, cell*2, (cell*3)/2))
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.White,
+		Face: face,
+		Dot:  fixed.P(cell/2, cell),
+	}
+	d.DrawString(string(c))
+	return dst
+}
+
+var serveTemplate = template.Must(template.New("serve").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>wgl4-side-by-side</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+tr { border-bottom: 1px solid #e0e0e0; }
+td { padding: 0 8px; }
+td.glyph { border-left: 1px solid #e0e0e0; }
+td.diff { background-color: #ffffcc; }
+td.missing { background-color: #ffc0c0; font-size: small; }
+td.name { color: #808080; font-size: small; }
+form { margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<form method="get" action="/">
+<fieldset><legend>Fonts</legend>
+{{range .Fonts}}<label><input type="checkbox" name="f" value="{{.Index}}"{{if .Selected}} checked{{end}}> {{.Index}}: {{.Name}}</label><br>
+{{end}}</fieldset>
+<label>Size <input type="number" name="size" min="6" max="256" value="{{.Size}}"></label>
+<label>Hinting <select name="hinting">{{$h := .Hinting}}{{range .Hintings}}<option{{if eq . $h}} selected{{end}}>{{.}}</option>{{end}}</select></label>
+<label>Rendering <select name="render"><option value="aa"{{if eq .Render "aa"}} selected{{end}}>antialiased</option><option value="mono"{{if eq .Render "mono"}} selected{{end}}>monochrome</option></select></label>
+<label>Code points <input type="text" name="lo" size="6" value="{{.Lo}}"> up to <input type="text" name="hi" size="6" value="{{.Hi}}"></label>
+<label><input type="checkbox" name="diff" value="1"{{if .Diff}} checked{{end}}> Highlight differences from the first font with each glyph</label>
+<input type="submit" value="Show">
+</form>
+{{if .Truncated}}<p>Only the first {{.Max}} glyphs are shown.</p>
+{{end}}<table>
+{{range .Rows}}<tr>{{range .Cells}}<td class="glyph{{if .Diff}} diff{{end}}{{if .Missing}} missing{{end}}">{{if .Missing}}missing{{else}}<a href="{{.Zoom}}"><img src="{{.Src}}" alt=""></a>{{end}}</td>{{end}}<td>{{.Code}}</td><td class="name">{{.Name}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
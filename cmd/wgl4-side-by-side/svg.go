@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+
+	"github.com/nigeltao/fontscripts/repertoire"
+
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/unicode/runenames"
+)
+
+// doSVG is like do, but writes an SVG image with the glyphs' vector outlines
+// instead of a PNG image. It uses the same layout as the PNG image, so that
+// 1 SVG user unit corresponds to 1 PNG pixel.
+func doSVG(fs *faceSet, page repertoire.Set, stdout io.Writer) {
+	lo, hi := page[0], page[len(page)-1]+1
+	yMax := pageHeight(len(page))
+	w := pageWidth(fs)
+	h := yMax + footerHeight()
+
+	filename := outputFilename(lo, hi, ".svg")
+	outFile, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outFile.Close()
+	b := bufio.NewWriter(outFile)
+
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", w, h, w, h)
+	fmt.Fprintf(b, `<rect width="%d" height="%d" fill="%s"/>`+"\n", w, h, svgColor(colors.background))
+	fmt.Fprintf(b, `<g fill="%s">`+"\n", svgColor(colors.foreground))
+	for j := range fs.large {
+		x, _ := cellOrigin(0, j)
+		fmt.Fprintf(b, `<line x1="%d" y1="0" x2="%d" y2="%d" stroke="%s"/>`+"\n", x, x, yMax, svgColor(colors.rule))
+	}
+
+	var buf sfnt.Buffer
+	for i, c := range page {
+		_, y := cellOrigin(i, 0)
+		fmt.Fprintf(b, `<line x1="0" y1="%d" x2="%d" y2="%d" stroke="%s"/>`+"\n", y, w, y, svgColor(colors.rule))
+		fmt.Fprintf(b, `<text x="%d" y="%d" font-family="sans-serif" font-size="24">U+%04X</text>`+"\n",
+			width*len(fs.large)+64, y, c)
+		fmt.Fprintf(b, `<text x="%d" y="%d" font-family="sans-serif" font-size="10" fill="%s">%s</text>`+"\n",
+			width*len(fs.large)+64, y+12, svgColor(colors.label), html.EscapeString(runenames.Name(c)))
+
+		for j := range fs.large {
+			cx, _ := cellOrigin(i, j)
+			f, va := sfntFonts[j/len(variants)], variants[j%len(variants)]
+			x, err := f.GlyphIndex(&buf, c)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if x == 0 {
+				r := cellRect(i, j)
+				fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n",
+					r.Min.X, r.Min.Y, r.Dx(), r.Dy(), svgColor(colors.missing))
+				fmt.Fprintf(b, `<text x="%d" y="%d" font-family="sans-serif" font-size="10">missing</text>`+"\n",
+					cx, y-largeHeight/2)
+				continue
+			}
+			fmt.Fprintf(b, `<g transform="translate(%d %d)">`+"\n", cx, y)
+			if *guidesFlag {
+				advance, err := f.GlyphAdvance(&buf, x, fixed.I(va.ppem), va.hinting)
+				if err != nil {
+					log.Fatal(err)
+				}
+				fmt.Fprintf(b, `<line x1="%g" y1="%d" x2="%g" y2="%d" stroke="#80c0ff"/>`+"\n",
+					f26_6(advance), -largeHeight, f26_6(advance), largeHeight/4)
+				fmt.Fprintf(b, `<line x1="0" y1="0" x2="%g" y2="0" stroke="#80c0ff"/>`+"\n", f26_6(advance))
+			}
+			segments, err := f.LoadGlyph(&buf, x, fixed.I(va.ppem), nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			writeSVGPath(b, segments)
+			if *pointsFlag {
+				writeSVGPoints(b, segments)
+			}
+			b.WriteString("</g>\n")
+		}
+	}
+
+	for i := range names {
+		fmt.Fprintf(b, `<text x="16" y="%d" font-family="sans-serif" font-size="24">%s</text>`+"\n",
+			yMax+(i+1)*smallHeight, html.EscapeString(footerName(i)))
+	}
+	if len(variants) > 1 {
+		fmt.Fprintf(b, `<text x="16" y="%d" font-family="sans-serif" font-size="24" fill="%s">Columns per font: %s</text>`+"\n",
+			yMax+(len(names)+1)*smallHeight, svgColor(colors.label), html.EscapeString(variantLabels()))
+	}
+	b.WriteString("</g>\n</svg>\n")
+
+	err = b.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(stdout, "Wrote %s\n", filename)
+}
+
+// f26_6 converts from 26.6 fixed point to floating point.
+func f26_6(x fixed.Int26_6) float64 {
+	return float64(x) / 64
+}
+
+func writeSVGPath(b *bufio.Writer, segments sfnt.Segments) {
+	if len(segments) == 0 {
+		return
+	}
+	b.WriteString(`<path fill-rule="nonzero" d="`)
+	for i, seg := range segments {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			if i > 0 {
+				b.WriteString("Z ")
+			}
+			fmt.Fprintf(b, "M%g,%g", f26_6(seg.Args[0].X), f26_6(seg.Args[0].Y))
+		case sfnt.SegmentOpLineTo:
+			fmt.Fprintf(b, "L%g,%g", f26_6(seg.Args[0].X), f26_6(seg.Args[0].Y))
+		case sfnt.SegmentOpQuadTo:
+			fmt.Fprintf(b, "Q%g,%g %g,%g",
+				f26_6(seg.Args[0].X), f26_6(seg.Args[0].Y),
+				f26_6(seg.Args[1].X), f26_6(seg.Args[1].Y))
+		case sfnt.SegmentOpCubeTo:
+			fmt.Fprintf(b, "C%g,%g %g,%g %g,%g",
+				f26_6(seg.Args[0].X), f26_6(seg.Args[0].Y),
+				f26_6(seg.Args[1].X), f26_6(seg.Args[1].Y),
+				f26_6(seg.Args[2].X), f26_6(seg.Args[2].Y))
+		}
+	}
+	b.WriteString(` Z"/>` + "\n")
+}
+
+// writeSVGPoints marks the on-curve points with filled circles and the
+// off-curve (control) points with hollow circles.
+func writeSVGPoints(b *bufio.Writer, segments sfnt.Segments) {
+	for _, seg := range segments {
+		n := 1
+		switch seg.Op {
+		case sfnt.SegmentOpQuadTo:
+			n = 2
+		case sfnt.SegmentOpCubeTo:
+			n = 3
+		}
+		for k := 0; k < n; k++ {
+			p := seg.Args[k]
+			if k == n-1 {
+				fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="0.75" fill="#ff0000"/>`+"\n", f26_6(p.X), f26_6(p.Y))
+			} else {
+				fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="0.75" fill="none" stroke="#0000ff" stroke-width="0.25"/>`+"\n",
+					f26_6(p.X), f26_6(p.Y))
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"log"
+	"os"
+
+	"github.com/nigeltao/fontscripts/repertoire"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/unicode/runenames"
+)
+
+// waterfallSizes are the -waterfall flag's pixel sizes.
+var waterfallSizes = []int{8, 9, 10, 11, 12, 13, 14, 16, 18, 20, 24, 28, 32, 36, 48, 60, 72}
+
+// waterfallLabelWidth is the width of the column, left of the glyphs, that
+// labels each row with its source font and mode.
+const waterfallLabelWidth = 128
+
+// numModes returns the number of hinting and rendering modes per size.
+func numModes() int {
+	return len(variants) / len(waterfallSizes)
+}
+
+// waterfallGroupHeight is the height of each glyph's rows: one per source
+// font and mode, and a gap.
+func waterfallGroupHeight() int {
+	return largeHeight*len(names)*numModes() + largeHeight/4
+}
+
+// doWaterfall is like do, but draws each glyph at each of the waterfallSizes,
+// from left to right, with one row per source font and mode.
+func doWaterfall(fs *faceSet, page repertoire.Set, stdout io.Writer) {
+	lo, hi := page[0], page[len(page)-1]+1
+	yMax := pageHeight(len(page))
+
+	slots := make([]int, len(waterfallSizes))
+	x := waterfallLabelWidth
+	for i, size := range waterfallSizes {
+		slots[i] = x
+		x += (size*5)/4 + 8
+	}
+	codeX := x + 32
+
+	w := codeX + listLabelWidth
+	if fw := footerWidth(fs); w < fw {
+		w = fw
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, yMax+footerHeight()))
+	bounds := dst.Bounds()
+	draw.Draw(dst, bounds, image.NewUniform(colors.background), image.Point{}, draw.Src)
+
+	pink := image.NewUniform(colors.missing)
+	fg := image.NewUniform(colors.foreground)
+	gray := image.NewUniform(colors.label)
+	d := &font.Drawer{
+		Dst: dst,
+	}
+
+	d.Src = gray
+	d.Face = fs.labelTiny
+	for i, size := range waterfallSizes {
+		d.Dot = fixed.P(slots[i], smallHeight/2)
+		d.DrawString(fmt.Sprintf("%d", size))
+	}
+
+	nModes := numModes()
+	y := smallHeight
+	for _, c := range page {
+		hLine(dst, bounds.Min.X, bounds.Max.X-1, y, colors.separator)
+
+		d.Src = fg
+		d.Face = fs.labelSmall
+		d.Dot = fixed.P(codeX, y+largeHeight)
+		d.DrawString(fmt.Sprintf("U+%04X", c))
+
+		d.Src = gray
+		d.Face = fs.labelTiny
+		d.Dot = fixed.P(codeX, y+largeHeight+12)
+		d.DrawString(runenames.Name(c))
+
+		s := string(c)
+		for j := range names {
+			for m := 0; m < nModes; m++ {
+				y += largeHeight
+				hLine(dst, waterfallLabelWidth, codeX-1, y, colors.rule)
+
+				d.Src = gray
+				d.Face = fs.labelTiny
+				d.Dot = fixed.P(16, y)
+				d.DrawString(fmt.Sprintf("%d %s", j, variants[m].mode))
+
+				if isMissing(column(j, 0), c) {
+					draw.Draw(dst, image.Rect(waterfallLabelWidth, y-largeHeight+largeHeight/8, codeX, y+largeHeight/8),
+						pink, image.Point{}, draw.Src)
+					d.Src = fg
+					d.Dot = fixed.P(waterfallLabelWidth+8, y-largeHeight/2)
+					d.DrawString("missing")
+					continue
+				}
+
+				d.Src = fg
+				for i := range waterfallSizes {
+					d.Face = fs.large[column(j, i*nModes+m)]
+					d.Dot = fixed.P(slots[i], y)
+					d.DrawString(s)
+				}
+			}
+		}
+		y += largeHeight / 4
+	}
+
+	for i := range names {
+		d.Src = fg
+		d.Face = fs.small[i]
+		d.Dot = fixed.P(16, yMax+(i+1)*smallHeight)
+		d.DrawString(footerName(i))
+	}
+
+	filename := outputFilename(lo, hi, "-waterfall.png")
+	outFile, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outFile.Close()
+	b := bufio.NewWriter(outFile)
+	err = png.Encode(b, dst)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = b.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(stdout, "Wrote %s\n", filename)
+}
+
+// monoFace is a font.Face whose glyphs are 1-bit monochrome: each pixel is
+// fully opaque if the wrapped face's antialiased pixel is at least half
+// opaque, and fully transparent otherwise.
+type monoFace struct {
+	font.Face
+}
+
+func (f monoFace) Glyph(dot fixed.Point26_6, r rune) (
+	dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+
+	dr, mask, maskp, advance, ok = f.Face.Glyph(dot, r)
+	if !ok {
+		return dr, mask, maskp, advance, ok
+	}
+	m := image.NewAlpha(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+	for y := 0; y < dr.Dy(); y++ {
+		for x := 0; x < dr.Dx(); x++ {
+			if _, _, _, a := mask.At(maskp.X+x, maskp.Y+y).RGBA(); a >= 0x8000 {
+				m.SetAlpha(x, y, color.Alpha{0xff})
+			}
+		}
+	}
+	return dr, m, image.Point{}, advance, ok
+}
@@ -0,0 +1,205 @@
+// Package fontfile loads font files as single SFNT (TrueType or OpenType)
+// fonts: TTF and OTF files as is, one font of a TTC or OTC collection, and
+// WOFF and WOFF2 web fonts, decompressed.
+package fontfile
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sfntTable is a table of an SFNT font file.
+type sfntTable struct {
+	tag      uint32
+	checksum uint32
+	data     []byte
+}
+
+// Load reads the font file named by arg and returns it as a single SFNT font:
+// a TTF or OTF file is returned as is, a WOFF or WOFF2 file is decompressed
+// and a TTC or OTC file, or a WOFF2 file of a collection, has one font
+// extracted. That font is given by an index suffix such as
+// "NotoSansCJK.ttc#2", defaulting to the 0th font.
+func Load(arg string) ([]byte, error) {
+	filename, index := SplitArg(arg)
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(src) < 4 {
+		return nil, fmt.Errorf("%s: not a font file", filename)
+	}
+
+	switch string(src[:4]) {
+	case "ttcf":
+		if index < 0 {
+			index = 0
+		}
+		src, err = extractCollectionFont(src, index)
+	case "wOF2":
+		src, err = decodeWOFF2(src, index)
+	default:
+		if index >= 0 {
+			err = errNotCollection
+		} else if string(src[:4]) == "wOFF" {
+			src, err = decodeWOFF(src)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return src, nil
+}
+
+// SplitArg splits a Load arg such as "NotoSansCJK.ttc#2" into its filename
+// and index suffix. The index is -1 if there is no suffix.
+func SplitArg(arg string) (filename string, index int) {
+	if i := strings.LastIndexByte(arg, '#'); i >= 0 {
+		if n, err := strconv.Atoi(arg[i+1:]); err == nil && n >= 0 {
+			return arg[:i], n
+		}
+	}
+	return arg, -1
+}
+
+// BaseName returns the filename part of a Load arg, less directories and
+// extension, keeping any index suffix as "-2" instead of "#2".
+func BaseName(arg string) string {
+	filename, index := SplitArg(arg)
+	suffix := ""
+	if index >= 0 {
+		suffix = "-" + strconv.Itoa(index)
+	}
+	base := filepath.Base(filename)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + suffix
+}
+
+var (
+	errInvalidFont   = errors.New("invalid font file")
+	errNotCollection = errors.New("an index suffix needs a TTC or OTC font collection")
+)
+
+func errIndexOutOfRange(index, numFonts int) error {
+	return fmt.Errorf("font index %d out of range: the collection has %d fonts", index, numFonts)
+}
+
+// extractCollectionFont returns the index'th font of a TTC or OTC collection
+// as a standalone SFNT font.
+func extractCollectionFont(src []byte, index int) ([]byte, error) {
+	if len(src) < 12 {
+		return nil, errInvalidFont
+	}
+	numFonts := int(binary.BigEndian.Uint32(src[8:]))
+	if index >= numFonts {
+		return nil, errIndexOutOfRange(index, numFonts)
+	}
+	if len(src) < 12+4*numFonts {
+		return nil, errInvalidFont
+	}
+	offset := int(binary.BigEndian.Uint32(src[12+4*index:]))
+	if offset < 0 || len(src)-offset < 12 {
+		return nil, errInvalidFont
+	}
+	flavor := binary.BigEndian.Uint32(src[offset:])
+	numTables := int(binary.BigEndian.Uint16(src[offset+4:]))
+	dir := src[offset+12:]
+	if len(dir) < 16*numTables {
+		return nil, errInvalidFont
+	}
+	tables := make([]sfntTable, numTables)
+	for i := range tables {
+		e := dir[16*i:]
+		tOffset := int(binary.BigEndian.Uint32(e[8:]))
+		tLength := int(binary.BigEndian.Uint32(e[12:]))
+		if tOffset < 0 || tLength < 0 || len(src)-tOffset < tLength {
+			return nil, errInvalidFont
+		}
+		tables[i] = sfntTable{
+			tag:      binary.BigEndian.Uint32(e[0:]),
+			checksum: binary.BigEndian.Uint32(e[4:]),
+			data:     src[tOffset : tOffset+tLength],
+		}
+	}
+	return buildSFNT(flavor, tables), nil
+}
+
+// decodeWOFF returns the SFNT font compressed in a WOFF (version 1) file.
+func decodeWOFF(src []byte) ([]byte, error) {
+	const headerSize, entrySize = 44, 20
+	if len(src) < headerSize {
+		return nil, errInvalidFont
+	}
+	flavor := binary.BigEndian.Uint32(src[4:])
+	numTables := int(binary.BigEndian.Uint16(src[12:]))
+	if len(src) < headerSize+entrySize*numTables {
+		return nil, errInvalidFont
+	}
+	tables := make([]sfntTable, numTables)
+	for i := range tables {
+		e := src[headerSize+entrySize*i:]
+		tOffset := int(binary.BigEndian.Uint32(e[4:]))
+		compLength := int(binary.BigEndian.Uint32(e[8:]))
+		origLength := int(binary.BigEndian.Uint32(e[12:]))
+		if tOffset < 0 || compLength < 0 || len(src)-tOffset < compLength {
+			return nil, errInvalidFont
+		}
+		data := src[tOffset : tOffset+compLength]
+		if compLength < origLength {
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			data, err = ioutil.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(data) != origLength {
+			return nil, errInvalidFont
+		}
+		tables[i] = sfntTable{
+			tag:      binary.BigEndian.Uint32(e[0:]),
+			checksum: binary.BigEndian.Uint32(e[16:]),
+			data:     data,
+		}
+	}
+	return buildSFNT(flavor, tables), nil
+}
+
+// buildSFNT returns an SFNT font file with the given flavor (such as
+// 0x00010000 for TrueType outlines or "OTTO" for CFF outlines) and tables.
+func buildSFNT(flavor uint32, tables []sfntTable) []byte {
+	entrySelector := 0
+	for 2<<uint(entrySelector) <= len(tables) {
+		entrySelector++
+	}
+	searchRange := 16 << uint(entrySelector)
+
+	offset := 12 + 16*len(tables)
+	dst := make([]byte, offset)
+	binary.BigEndian.PutUint32(dst[0:], flavor)
+	binary.BigEndian.PutUint16(dst[4:], uint16(len(tables)))
+	binary.BigEndian.PutUint16(dst[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(dst[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(dst[10:], uint16(16*len(tables)-searchRange))
+	for i, t := range tables {
+		e := dst[12+16*i:]
+		binary.BigEndian.PutUint32(e[0:], t.tag)
+		binary.BigEndian.PutUint32(e[4:], t.checksum)
+		binary.BigEndian.PutUint32(e[8:], uint32(offset))
+		binary.BigEndian.PutUint32(e[12:], uint32(len(t.data)))
+		dst = append(dst, t.data...)
+		for len(dst)%4 != 0 {
+			dst = append(dst, 0)
+		}
+		offset = len(dst)
+	}
+	return dst
+}
@@ -0,0 +1,235 @@
+package fontfile
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+)
+
+var goFonts = []struct {
+	name string
+	ttf  []byte
+}{
+	{"goregular", goregular.TTF},
+	{"gobold", gobold.TTF},
+	{"gomono", gomono.TTF},
+}
+
+// readTables returns an SFNT font's flavor and tables.
+func readTables(t *testing.T, src []byte) (uint32, []sfntTable) {
+	t.Helper()
+	numTables := int(binary.BigEndian.Uint16(src[4:]))
+	tables := make([]sfntTable, numTables)
+	for i := range tables {
+		e := src[12+16*i:]
+		offset := binary.BigEndian.Uint32(e[8:])
+		length := binary.BigEndian.Uint32(e[12:])
+		tables[i] = sfntTable{
+			tag:      binary.BigEndian.Uint32(e[0:]),
+			checksum: binary.BigEndian.Uint32(e[4:]),
+			data:     src[offset : offset+length],
+		}
+	}
+	return binary.BigEndian.Uint32(src[0:]), tables
+}
+
+// rebuild returns an SFNT font as buildSFNT lays it out, which is what the
+// decoders should return for it.
+func rebuild(t *testing.T, src []byte) []byte {
+	t.Helper()
+	return buildSFNT(readTables(t, src))
+}
+
+// checkFont checks that got is a valid font with the same glyphs as want.
+func checkFont(t *testing.T, got []byte, want []byte) {
+	t.Helper()
+	g, err := sfnt.Parse(got)
+	if err != nil {
+		t.Fatalf("sfnt.Parse: %v", err)
+	}
+	w, err := sfnt.Parse(want)
+	if err != nil {
+		t.Fatalf("sfnt.Parse: %v", err)
+	}
+	if g.NumGlyphs() != w.NumGlyphs() {
+		t.Fatalf("NumGlyphs: got %d, want %d", g.NumGlyphs(), w.NumGlyphs())
+	}
+	var buf sfnt.Buffer
+	gName, _ := g.Name(&buf, sfnt.NameIDFull)
+	wName, _ := w.Name(&buf, sfnt.NameIDFull)
+	if gName != wName {
+		t.Fatalf("full name: got %q, want %q", gName, wName)
+	}
+}
+
+func TestBuildSFNT(t *testing.T) {
+	for _, tc := range goFonts {
+		flavor, tables := readTables(t, tc.ttf)
+		got := buildSFNT(flavor, tables)
+		checkFont(t, got, tc.ttf)
+		if _, gotTables := readTables(t, got); len(gotTables) != len(tables) {
+			t.Errorf("%s: got %d tables, want %d", tc.name, len(gotTables), len(tables))
+		} else {
+			for i := range tables {
+				if g, w := gotTables[i], tables[i]; g.tag != w.tag || g.checksum != w.checksum || !bytes.Equal(g.data, w.data) {
+					t.Errorf("%s: table %d differs", tc.name, i)
+				}
+			}
+		}
+	}
+}
+
+// encodeWOFF returns an SFNT font as a WOFF file, compressing its tables.
+func encodeWOFF(t *testing.T, src []byte) []byte {
+	flavor, tables := readTables(t, src)
+	const headerSize, entrySize = 44, 20
+	dst := make([]byte, headerSize+entrySize*len(tables))
+	copy(dst, "wOFF")
+	binary.BigEndian.PutUint32(dst[4:], flavor)
+	binary.BigEndian.PutUint16(dst[12:], uint16(len(tables)))
+	for i, table := range tables {
+		data := &bytes.Buffer{}
+		w := zlib.NewWriter(data)
+		w.Write(table.data)
+		w.Close()
+		compressed := data.Bytes()
+		if len(compressed) >= len(table.data) {
+			compressed = table.data
+		}
+		e := dst[headerSize+entrySize*i:]
+		binary.BigEndian.PutUint32(e[0:], table.tag)
+		binary.BigEndian.PutUint32(e[4:], uint32(len(dst)))
+		binary.BigEndian.PutUint32(e[8:], uint32(len(compressed)))
+		binary.BigEndian.PutUint32(e[12:], uint32(len(table.data)))
+		binary.BigEndian.PutUint32(e[16:], table.checksum)
+		dst = append(dst, compressed...)
+		for len(dst)%4 != 0 {
+			dst = append(dst, 0)
+		}
+	}
+	binary.BigEndian.PutUint32(dst[8:], uint32(len(dst)))
+	return dst
+}
+
+func TestDecodeWOFF(t *testing.T) {
+	for _, tc := range goFonts {
+		got, err := decodeWOFF(encodeWOFF(t, tc.ttf))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !bytes.Equal(got, rebuild(t, tc.ttf)) {
+			t.Errorf("%s: decoded WOFF differs from the original", tc.name)
+		}
+	}
+
+	woff := encodeWOFF(t, goregular.TTF)
+	for _, n := range []int{0, 43, len(woff) / 2} {
+		if _, err := decodeWOFF(woff[:n]); err == nil {
+			t.Errorf("truncated to %d bytes: got nil error", n)
+		}
+	}
+}
+
+// encodeCollection returns SFNT fonts as a TTC file, without sharing tables.
+func encodeCollection(t *testing.T, fonts ...[]byte) []byte {
+	dst := make([]byte, 12+4*len(fonts))
+	copy(dst, "ttcf")
+	binary.BigEndian.PutUint32(dst[4:], 0x00010000)
+	binary.BigEndian.PutUint32(dst[8:], uint32(len(fonts)))
+	for i, src := range fonts {
+		binary.BigEndian.PutUint32(dst[12+4*i:], uint32(len(dst)))
+		start := len(dst)
+		dst = append(dst, src[:12+16*int(binary.BigEndian.Uint16(src[4:]))]...)
+		_, tables := readTables(t, src)
+		for j, table := range tables {
+			binary.BigEndian.PutUint32(dst[start+12+16*j+8:], uint32(len(dst)))
+			dst = append(dst, table.data...)
+			for len(dst)%4 != 0 {
+				dst = append(dst, 0)
+			}
+		}
+	}
+	return dst
+}
+
+func TestExtractCollectionFont(t *testing.T) {
+	ttc := encodeCollection(t, goregular.TTF, gobold.TTF, gomono.TTF)
+	for i, tc := range goFonts {
+		got, err := extractCollectionFont(ttc, i)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !bytes.Equal(got, rebuild(t, tc.ttf)) {
+			t.Errorf("%s: extracted font differs from the original", tc.name)
+		}
+	}
+	if _, err := extractCollectionFont(ttc, 3); err == nil {
+		t.Errorf("index 3: got nil error")
+	}
+	if _, err := extractCollectionFont(ttc[:100], 0); err == nil {
+		t.Errorf("truncated: got nil error")
+	}
+}
+
+func TestSplitArgBaseName(t *testing.T) {
+	testCases := []struct {
+		arg      string
+		filename string
+		index    int
+		baseName string
+	}{
+		{"Go-Regular.ttf", "Go-Regular.ttf", -1, "Go-Regular"},
+		{"fonts/NotoSansCJK.ttc#2", "fonts/NotoSansCJK.ttc", 2, "NotoSansCJK-2"},
+		{"a#b.ttf", "a#b.ttf", -1, "a#b"},
+		{"x.ttc#-1", "x.ttc#-1", -1, "x"},
+	}
+	for _, tc := range testCases {
+		filename, index := SplitArg(tc.arg)
+		if filename != tc.filename || index != tc.index {
+			t.Errorf("SplitArg(%q): got %q, %d, want %q, %d", tc.arg, filename, index, tc.filename, tc.index)
+		}
+		if got := BaseName(tc.arg); got != tc.baseName {
+			t.Errorf("BaseName(%q): got %q, want %q", tc.arg, got, tc.baseName)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"go.ttf":   goregular.TTF,
+		"go.woff":  encodeWOFF(t, goregular.TTF),
+		"go.woff2": encodeWOFF2(t, goregular.TTF, false, false),
+		"go.ttc":   encodeCollection(t, gobold.TTF, goregular.TTF),
+		"tiny.ttf": []byte("OT"),
+	}
+	for name, b := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, arg := range []string{"go.ttf", "go.woff", "go.woff2", "go.ttc#1"} {
+		got, err := Load(filepath.Join(dir, arg))
+		if err != nil {
+			t.Errorf("%s: %v", arg, err)
+			continue
+		}
+		checkFont(t, got, goregular.TTF)
+	}
+	for _, arg := range []string{"go.ttf#0", "go.ttc#2", "tiny.ttf", "missing.ttf"} {
+		if _, err := Load(filepath.Join(dir, arg)); err == nil {
+			t.Errorf("%s: got nil error", arg)
+		}
+	}
+}
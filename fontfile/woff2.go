@@ -0,0 +1,562 @@
+package fontfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/andybalholm/brotli"
+)
+
+// woff2Tags are the WOFF2 table directory's known tags, by their 6-bit index.
+var woff2Tags = [63]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post",
+	"cvt ", "fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT",
+	"EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea",
+	"vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH",
+	"CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar",
+	"gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+	"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+// woff2Table is a WOFF2 table directory entry. Its data is the length bytes
+// at offset in the decompressed stream, which is origLength bytes unless the
+// table is transformed.
+type woff2Table struct {
+	tag         string
+	transformed bool
+	origLength  int
+	offset      int
+	length      int
+}
+
+// decodeWOFF2 returns the SFNT font compressed in a WOFF2 file. For a WOFF2
+// file of a font collection, it returns the index'th font, defaulting to the
+// 0th, and otherwise the index must be -1.
+//
+// The glyf, loca and hmtx tables' transforms are reversed, but the glyphs'
+// flags and coordinates are not packed as tightly as the original font's, so
+// the glyf table may be larger.
+func decodeWOFF2(src []byte, index int) ([]byte, error) {
+	const headerSize = 48
+	if len(src) < headerSize {
+		return nil, errInvalidFont
+	}
+	flavor := binary.BigEndian.Uint32(src[4:])
+	numTables := int(binary.BigEndian.Uint16(src[12:]))
+	compressedSize := int(binary.BigEndian.Uint32(src[20:]))
+
+	s := woff2Stream{b: src[headerSize:]}
+	tables := make([]woff2Table, numTables)
+	totalLength := 0
+	for i := range tables {
+		flags := s.u8()
+		tag := ""
+		if flags&0x3f == 0x3f {
+			tag = string(s.bytes(4))
+		} else {
+			tag = woff2Tags[flags&0x3f]
+		}
+		// Version 0 is the null transform, except for glyf and loca,
+		// whose null transform is version 3.
+		version := flags >> 6
+		transformed := version != 0
+		if tag == "glyf" || tag == "loca" {
+			transformed = version != 3
+		}
+		origLength := int(s.base128())
+		length := origLength
+		if transformed {
+			length = int(s.base128())
+		}
+		tables[i] = woff2Table{
+			tag:         tag,
+			transformed: transformed,
+			origLength:  origLength,
+			offset:      totalLength,
+			length:      length,
+		}
+		totalLength += length
+	}
+
+	fontTables := make([]int, numTables)
+	for i := range fontTables {
+		fontTables[i] = i
+	}
+	if string(src[4:8]) == "ttcf" {
+		if index < 0 {
+			index = 0
+		}
+		s.u32() // The collection header's version.
+		numFonts := int(s.u255())
+		if index >= numFonts {
+			return nil, errIndexOutOfRange(index, numFonts)
+		}
+		for i := 0; i < numFonts && !s.bad; i++ {
+			n := int(s.u255())
+			f := s.u32()
+			ts := make([]int, n)
+			for j := range ts {
+				ts[j] = int(s.u255())
+				if ts[j] >= numTables {
+					return nil, errInvalidFont
+				}
+			}
+			if i == index {
+				flavor, fontTables = f, ts
+			}
+		}
+	} else if index >= 0 {
+		return nil, errNotCollection
+	}
+	compressed := s.bytes(compressedSize)
+	if s.bad {
+		return nil, errInvalidFont
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(brotli.NewReader(bytes.NewReader(compressed)), int64(totalLength)+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing WOFF2 data: %v", err)
+	}
+	if len(data) != totalLength {
+		return nil, errInvalidFont
+	}
+
+	entries := map[string]woff2Table{}
+	for _, k := range fontTables {
+		entries[tables[k].tag] = tables[k]
+	}
+	tableData := map[string][]byte{}
+	for tag, t := range entries {
+		if t.transformed {
+			if tag != "glyf" && tag != "loca" && tag != "hmtx" {
+				return nil, fmt.Errorf("unsupported WOFF2 transform of the %q table", tag)
+			}
+			continue
+		}
+		if t.length != t.origLength {
+			return nil, errInvalidFont
+		}
+		tableData[tag] = data[t.offset : t.offset+t.length]
+	}
+
+	var xMins []int16
+	if g := entries["glyf"]; g.transformed {
+		if l, ok := entries["loca"]; !ok || !l.transformed || l.length != 0 {
+			return nil, errInvalidFont
+		}
+		tableData["glyf"], tableData["loca"], xMins, err = reconstructGlyf(data[g.offset : g.offset+g.length])
+		if err != nil {
+			return nil, err
+		}
+	} else if entries["loca"].transformed {
+		return nil, errInvalidFont
+	}
+	if h := entries["hmtx"]; h.transformed {
+		hhea := tableData["hhea"]
+		if xMins == nil || len(hhea) < 36 {
+			return nil, errInvalidFont
+		}
+		numHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+		tableData["hmtx"], err = reconstructHmtx(data[h.offset:h.offset+h.length], numHMetrics, xMins)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sfntTables := make([]sfntTable, 0, len(tableData))
+	for tag, d := range tableData {
+		sfntTables = append(sfntTables, sfntTable{
+			tag:      binary.BigEndian.Uint32([]byte(tag)),
+			checksum: tableChecksum(tag, d),
+			data:     d,
+		})
+	}
+	sort.Slice(sfntTables, func(i, j int) bool {
+		return sfntTables[i].tag < sfntTables[j].tag
+	})
+	return buildSFNT(flavor, sfntTables), nil
+}
+
+// tableChecksum returns the SFNT checksum of a table's data. The head table's
+// checksum skips its checksumAdjustment field.
+func tableChecksum(tag string, data []byte) (sum uint32) {
+	for b := data; len(b) > 0; {
+		var word [4]byte
+		b = b[copy(word[:], b):]
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	if tag == "head" && len(data) >= 12 {
+		sum -= binary.BigEndian.Uint32(data[8:])
+	}
+	return sum
+}
+
+// reconstructGlyf returns the glyf and loca tables, and each glyph's xMin,
+// from a transformed glyf table.
+func reconstructGlyf(src []byte) (glyf []byte, loca []byte, xMins []int16, err error) {
+	const headerSize = 36
+	if len(src) < headerSize {
+		return nil, nil, nil, errInvalidFont
+	}
+	optionFlags := binary.BigEndian.Uint16(src[2:])
+	numGlyphs := int(binary.BigEndian.Uint16(src[4:]))
+	indexFormat := binary.BigEndian.Uint16(src[6:])
+
+	// The seven streams are, in order, each glyph's number of contours, each
+	// contour's number of points, each point's flag, each point's
+	// coordinates (and each glyph's instruction length), the composite
+	// glyphs' components, bounding boxes and instructions.
+	var streams [7]woff2Stream
+	h := woff2Stream{b: src[headerSize:]}
+	for i := range streams {
+		streams[i].b = h.bytes(int(binary.BigEndian.Uint32(src[8+4*i:])))
+	}
+	nContourStream, nPointsStream, flagStream, glyphStream := &streams[0], &streams[1], &streams[2], &streams[3]
+	compositeStream, bboxStream, instructionStream := &streams[4], &streams[5], &streams[6]
+	bboxBitmap := bboxStream.bytes(4 * ((numGlyphs + 31) / 32))
+	var overlapBitmap []byte
+	if optionFlags&1 != 0 {
+		overlapBitmap = h.bytes((numGlyphs + 7) / 8)
+	}
+	if h.bad || bboxStream.bad {
+		return nil, nil, nil, errInvalidFont
+	}
+	bit := func(bitmap []byte, i int) bool {
+		return bitmap[i>>3]&(0x80>>uint(i&7)) != 0
+	}
+
+	offsets := make([]int, numGlyphs+1)
+	xMins = make([]int16, numGlyphs)
+	for i := 0; i < numGlyphs; i++ {
+		nContours := int16(nContourStream.u16())
+		hasBBox := bit(bboxBitmap, i)
+		switch {
+		case nContours == 0:
+			if hasBBox {
+				return nil, nil, nil, errInvalidFont
+			}
+
+		case nContours == -1:
+			if !hasBBox {
+				return nil, nil, nil, errInvalidFont
+			}
+			glyf = appendUint16(glyf, uint16(nContours))
+			for j := 0; j < 4; j++ {
+				glyf = appendUint16(glyf, bboxStream.u16())
+			}
+			xMins[i] = int16(binary.BigEndian.Uint16(glyf[len(glyf)-8:]))
+			components, hasInstructions := compositeStream.composite()
+			glyf = append(glyf, components...)
+			if hasInstructions {
+				glyf = appendInstructions(glyf, glyphStream, instructionStream)
+			}
+
+		case nContours > 0:
+			glyf, xMins[i] = appendSimpleGlyph(glyf, int(nContours), hasBBox,
+				overlapBitmap != nil && bit(overlapBitmap, i),
+				nPointsStream, flagStream, glyphStream, bboxStream, instructionStream)
+
+		default:
+			return nil, nil, nil, errInvalidFont
+		}
+		for _, s := range streams {
+			if s.bad {
+				return nil, nil, nil, errInvalidFont
+			}
+		}
+		for len(glyf)%4 != 0 {
+			glyf = append(glyf, 0)
+		}
+		offsets[i+1] = len(glyf)
+	}
+
+	for _, o := range offsets {
+		if indexFormat == 0 {
+			if o > 0x1fffe {
+				return nil, nil, nil, errInvalidFont
+			}
+			loca = appendUint16(loca, uint16(o/2))
+		} else {
+			loca = appendUint32(loca, uint32(o))
+		}
+	}
+	return glyf, loca, xMins, nil
+}
+
+// appendSimpleGlyph appends a simple glyph, decoded from the transformed glyf
+// table's streams, and returns its xMin. The flags and coordinates are written
+// without repeats, but with one-byte coordinates where they fit.
+func appendSimpleGlyph(glyf []byte, nContours int, hasBBox bool, overlap bool,
+	nPointsStream, flagStream, glyphStream, bboxStream, instructionStream *woff2Stream) ([]byte, int16) {
+
+	endPts := make([]int, nContours)
+	numPoints := 0
+	for j := range endPts {
+		numPoints += int(nPointsStream.u255())
+		endPts[j] = numPoints - 1
+	}
+	if numPoints > 0xffff || numPoints > len(flagStream.b) {
+		flagStream.bad = true
+		return glyf, 0
+	}
+	pointFlags := flagStream.bytes(numPoints)
+
+	var xs, ys []byte
+	x, y := 0, 0
+	xMin, yMin, xMax, yMax := 0, 0, 0, 0
+	flags := make([]byte, numPoints)
+	for j, f := range pointFlags {
+		dx, dy := glyphStream.triplet(f & 0x7f)
+		flags[j], xs = appendCoordinate(xs, dx, 0x02, 0x10)
+		var yFlag byte
+		yFlag, ys = appendCoordinate(ys, dy, 0x04, 0x20)
+		flags[j] |= yFlag
+		if f&0x80 == 0 {
+			flags[j] |= 0x01 // ON_CURVE_POINT.
+		}
+
+		x, y = x+dx, y+dy
+		if j == 0 || x < xMin {
+			xMin = x
+		}
+		if j == 0 || x > xMax {
+			xMax = x
+		}
+		if j == 0 || y < yMin {
+			yMin = y
+		}
+		if j == 0 || y > yMax {
+			yMax = y
+		}
+	}
+	if overlap && numPoints > 0 {
+		flags[0] |= 0x40 // OVERLAP_SIMPLE.
+	}
+
+	glyf = appendUint16(glyf, uint16(nContours))
+	if hasBBox {
+		for j := 0; j < 4; j++ {
+			glyf = appendUint16(glyf, bboxStream.u16())
+		}
+	} else {
+		glyf = appendUint16(glyf, uint16(int16(xMin)))
+		glyf = appendUint16(glyf, uint16(int16(yMin)))
+		glyf = appendUint16(glyf, uint16(int16(xMax)))
+		glyf = appendUint16(glyf, uint16(int16(yMax)))
+	}
+	glyfXMin := int16(binary.BigEndian.Uint16(glyf[len(glyf)-8:]))
+	for _, e := range endPts {
+		glyf = appendUint16(glyf, uint16(e))
+	}
+	glyf = appendInstructions(glyf, glyphStream, instructionStream)
+	glyf = append(glyf, flags...)
+	glyf = append(glyf, xs...)
+	glyf = append(glyf, ys...)
+	return glyf, glyfXMin
+}
+
+// appendCoordinate appends a glyf coordinate delta and returns its flag bits:
+// none for a two-byte delta, isSame for a zero delta, which takes no bytes,
+// and isShort (plus isSame, for a positive delta) for a one-byte delta.
+func appendCoordinate(dst []byte, d int, isShort byte, isSame byte) (byte, []byte) {
+	switch {
+	case d == 0:
+		return isSame, dst
+	case 0 < d && d < 0x100:
+		return isShort | isSame, append(dst, byte(d))
+	case -0x100 < d && d < 0:
+		return isShort, append(dst, byte(-d))
+	}
+	return 0, appendUint16(dst, uint16(int16(d)))
+}
+
+// appendInstructions appends a glyph's instruction length, read from the
+// glyph stream, and that many instruction bytes, read from the instruction
+// stream.
+func appendInstructions(glyf []byte, glyphStream, instructionStream *woff2Stream) []byte {
+	n := glyphStream.u255()
+	glyf = appendUint16(glyf, n)
+	return append(glyf, instructionStream.bytes(int(n))...)
+}
+
+// reconstructHmtx returns the hmtx table from a transformed hmtx table, in
+// which the left side bearings may be omitted as equal to the glyphs' xMins.
+func reconstructHmtx(src []byte, numHMetrics int, xMins []int16) ([]byte, error) {
+	s := woff2Stream{b: src}
+	flags := s.u8()
+	proportionalLSBs, monospacedLSBs := flags&1 == 0, flags&2 == 0
+	if flags&^3 != 0 || (proportionalLSBs && monospacedLSBs) ||
+		numHMetrics < 1 || numHMetrics > len(xMins) {
+		return nil, errInvalidFont
+	}
+	advances := make([]uint16, numHMetrics)
+	for i := range advances {
+		advances[i] = s.u16()
+	}
+	lsbs := append([]int16(nil), xMins...)
+	for i := range lsbs {
+		if (i < numHMetrics && proportionalLSBs) || (i >= numHMetrics && monospacedLSBs) {
+			lsbs[i] = int16(s.u16())
+		}
+	}
+	if s.bad {
+		return nil, errInvalidFont
+	}
+
+	dst := make([]byte, 0, 2*numHMetrics+2*len(lsbs))
+	for i, lsb := range lsbs {
+		if i < numHMetrics {
+			dst = appendUint16(dst, advances[i])
+		}
+		dst = appendUint16(dst, uint16(lsb))
+	}
+	return dst, nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// woff2Stream reads from WOFF2 data. Reading past the end marks it bad and
+// returns zeroes, and so do invalid variable-length integers.
+type woff2Stream struct {
+	b   []byte
+	bad bool
+}
+
+func (s *woff2Stream) bytes(n int) []byte {
+	if n < 0 || len(s.b) < n {
+		s.b, s.bad = nil, true
+		return nil
+	}
+	ret := s.b[:n]
+	s.b = s.b[n:]
+	return ret
+}
+
+func (s *woff2Stream) u8() uint8 {
+	if b := s.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (s *woff2Stream) u16() uint16 {
+	if b := s.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (s *woff2Stream) u32() uint32 {
+	if b := s.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// base128 reads a UIntBase128: a big-endian base-128 integer of up to 5 bytes,
+// with the high bit set on all but the last byte.
+func (s *woff2Stream) base128() uint32 {
+	v := uint32(0)
+	for i := 0; i < 5; i++ {
+		b := s.u8()
+		if (i == 0 && b == 0x80) || v&0xfe000000 != 0 {
+			break
+		}
+		v = v<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	s.b, s.bad = nil, true
+	return 0
+}
+
+// u255 reads a 255UInt16: a variable-length encoding of a uint16 in one to
+// three bytes.
+func (s *woff2Stream) u255() uint16 {
+	switch c := s.u8(); c {
+	case 253:
+		return s.u16()
+	case 254:
+		return 2*253 + uint16(s.u8())
+	case 255:
+		return 253 + uint16(s.u8())
+	default:
+		return uint16(c)
+	}
+}
+
+// composite reads a composite glyph's components, returning their bytes and
+// whether the glyph has instructions.
+func (s *woff2Stream) composite() (components []byte, hasInstructions bool) {
+	start := s.b
+	for !s.bad {
+		flags := s.u16()
+		s.u16() // The component's glyph index.
+		n := 2
+		if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS.
+			n = 4
+		}
+		switch {
+		case flags&0x0008 != 0: // WE_HAVE_A_SCALE.
+			n += 2
+		case flags&0x0040 != 0: // WE_HAVE_AN_X_AND_Y_SCALE.
+			n += 4
+		case flags&0x0080 != 0: // WE_HAVE_A_TWO_BY_TWO.
+			n += 8
+		}
+		s.bytes(n)
+		hasInstructions = hasInstructions || flags&0x0100 != 0 // WE_HAVE_INSTRUCTIONS.
+		// MORE_COMPONENTS.
+		if flags&0x0020 == 0 {
+			break
+		}
+	}
+	if s.bad {
+		return nil, false
+	}
+	return start[:len(start)-len(s.b)], hasInstructions
+}
+
+// triplet reads a point's coordinate deltas, encoded as per the 7-bit flag.
+func (s *woff2Stream) triplet(flag byte) (dx int, dy int) {
+	withSign := func(f byte, v int) int {
+		if f&1 != 0 {
+			return v
+		}
+		return -v
+	}
+	f := int(flag)
+	switch {
+	case flag < 10:
+		b0 := int(s.u8())
+		return 0, withSign(flag, (f&14)<<7+b0)
+	case flag < 20:
+		b0 := int(s.u8())
+		return withSign(flag, ((f-10)&14)<<7+b0), 0
+	case flag < 84:
+		f -= 20
+		b0 := int(s.u8())
+		return withSign(flag, 1+(f&0x30)+b0>>4), withSign(flag>>1, 1+(f&0x0c)<<2+b0&0x0f)
+	case flag < 120:
+		f -= 84
+		b0, b1 := int(s.u8()), int(s.u8())
+		return withSign(flag, 1+(f/12)<<8+b0), withSign(flag>>1, 1+((f%12)>>2)<<8+b1)
+	case flag < 124:
+		b0, b1, b2 := int(s.u8()), int(s.u8()), int(s.u8())
+		return withSign(flag, b0<<4+b1>>4), withSign(flag>>1, (b1&0x0f)<<8+b2)
+	}
+	b0, b1, b2, b3 := int(s.u8()), int(s.u8()), int(s.u8()), int(s.u8())
+	return withSign(flag, b0<<8+b1), withSign(flag>>1, b2<<8+b3)
+}
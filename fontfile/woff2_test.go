@@ -0,0 +1,781 @@
+package fontfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+var updateFlag = flag.Bool("update", false, "rewrite the WOFF2 fixture in testdata")
+
+// woff2Fixture is the fixture font as a WOFF2 file with transformed glyf, loca
+// and hmtx tables. Run "go test -update" to rewrite it.
+const woff2Fixture = "testdata/goregular-subset.woff2"
+
+// fixtureDX and fixtureDY are the offset of the fixture font's composite
+// glyph's accent.
+const fixtureDX, fixtureDY = 307, 420
+
+// fixture is a small font built from Go Regular, for the WOFF2 transform
+// tests. Only a few simple glyphs are kept, the others being emptied, and the
+// glyph for U+00C1 is replaced by a composite of the glyphs for 'A' and
+// U+00B4 ACUTE ACCENT, which is offset by fixtureDX and fixtureDY. The 'A'
+// glyph has the OVERLAP_SIMPLE flag set. Every glyph's left side bearing is
+// its xMin, so the hmtx transform can omit them all.
+type fixture struct {
+	ttf       []byte
+	kept      []sfnt.GlyphIndex
+	composite sfnt.GlyphIndex
+	base      sfnt.GlyphIndex
+	accent    sfnt.GlyphIndex
+}
+
+func tagString(tag uint32) string {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, tag)
+	return string(b)
+}
+
+// tableMap returns an SFNT font's tables' data, keyed by tag.
+func tableMap(t *testing.T, src []byte) map[string][]byte {
+	t.Helper()
+	_, tables := readTables(t, src)
+	m := map[string][]byte{}
+	for _, table := range tables {
+		m[tagString(table.tag)] = table.data
+	}
+	return m
+}
+
+// splitGlyf returns each glyph's data, as per the loca table.
+func splitGlyf(t *testing.T, glyf []byte, loca []byte, indexFormat uint16) [][]byte {
+	t.Helper()
+	offsets := []int(nil)
+	if indexFormat == 0 {
+		for i := 0; i+2 <= len(loca); i += 2 {
+			offsets = append(offsets, 2*int(binary.BigEndian.Uint16(loca[i:])))
+		}
+	} else {
+		for i := 0; i+4 <= len(loca); i += 4 {
+			offsets = append(offsets, int(binary.BigEndian.Uint32(loca[i:])))
+		}
+	}
+	glyphs := make([][]byte, len(offsets)-1)
+	for i := range glyphs {
+		if offsets[i] > offsets[i+1] || offsets[i+1] > len(glyf) {
+			t.Fatalf("invalid loca entry for glyph %d", i)
+		}
+		glyphs[i] = glyf[offsets[i]:offsets[i+1]]
+	}
+	return glyphs
+}
+
+// bbox returns a glyph's xMin, yMin, xMax and yMax, or zeroes if it is empty.
+func bbox(g []byte) (b [4]int16) {
+	if len(g) >= 10 {
+		for i := range b {
+			b[i] = int16(binary.BigEndian.Uint16(g[2+2*i:]))
+		}
+	}
+	return b
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f, err := sfnt.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf sfnt.Buffer
+	glyphIndex := func(r rune) sfnt.GlyphIndex {
+		x, err := f.GlyphIndex(&buf, r)
+		if err != nil || x == 0 {
+			t.Fatalf("Go Regular has no glyph for U+%04X", r)
+		}
+		return x
+	}
+	fx := &fixture{
+		composite: glyphIndex('Á'),
+		base:      glyphIndex('A'),
+		accent:    glyphIndex('´'),
+	}
+	fx.kept = []sfnt.GlyphIndex{0, fx.base, fx.accent, glyphIndex('a'), glyphIndex('g'), glyphIndex('%')}
+
+	flavor, tables := readTables(t, goregular.TTF)
+	m := tableMap(t, goregular.TTF)
+	if binary.BigEndian.Uint16(m["head"][50:]) != 0 {
+		t.Fatal("Go Regular does not have a short loca table")
+	}
+	numHMetrics := int(binary.BigEndian.Uint16(m["hhea"][34:]))
+	glyphs := splitGlyf(t, m["glyf"], m["loca"], 0)
+
+	newGlyphs := make([][]byte, len(glyphs))
+	for _, x := range fx.kept {
+		newGlyphs[x] = glyphs[x]
+	}
+	// Set OVERLAP_SIMPLE on the base glyph's first flag, which follows its
+	// end points and instructions.
+	g := append([]byte(nil), glyphs[fx.base]...)
+	nContours := int(binary.BigEndian.Uint16(g))
+	instructionLength := int(binary.BigEndian.Uint16(g[10+2*nContours:]))
+	g[10+2*nContours+2+instructionLength] |= 0x40
+	newGlyphs[fx.base] = g
+
+	// The composite's first component has a scale of 1.0, to test that
+	// WE_HAVE_A_SCALE's bytes are kept, and its second has words for its
+	// arguments and two bytes of (no-op SVTCA) instructions.
+	b, a := bbox(glyphs[fx.base]), bbox(glyphs[fx.accent])
+	c := []int16{b[0], b[1], b[2], b[3]}
+	for i, d := range []int16{fixtureDX, fixtureDY, fixtureDX, fixtureDY} {
+		if v := a[i] + d; (i < 2 && v < c[i]) || (i >= 2 && v > c[i]) {
+			c[i] = v
+		}
+	}
+	composite := appendUint16(nil, 0xffff)
+	for _, v := range c {
+		composite = appendUint16(composite, uint16(v))
+	}
+	composite = appendUint16(composite, 0x0002|0x0008|0x0020)
+	composite = appendUint16(composite, uint16(fx.base))
+	composite = append(composite, 0, 0, 0x40, 0x00)
+	composite = appendUint16(composite, 0x0001|0x0002|0x0100)
+	composite = appendUint16(composite, uint16(fx.accent))
+	composite = appendUint16(composite, fixtureDX)
+	composite = appendUint16(composite, fixtureDY)
+	composite = append(composite, 0x00, 0x02, 0x00, 0x00)
+	newGlyphs[fx.composite] = composite
+
+	glyf, loca := []byte(nil), []byte(nil)
+	hmtx := append([]byte(nil), m["hmtx"]...)
+	for i, g := range newGlyphs {
+		loca = appendUint16(loca, uint16(len(glyf)/2))
+		glyf = append(glyf, g...)
+		for len(glyf)%4 != 0 {
+			glyf = append(glyf, 0)
+		}
+		lsb := hmtx[4*numHMetrics+2*(i-numHMetrics):]
+		if i < numHMetrics {
+			lsb = hmtx[4*i+2:]
+		}
+		binary.BigEndian.PutUint16(lsb, uint16(bbox(g)[0]))
+	}
+	loca = appendUint16(loca, uint16(len(glyf)/2))
+
+	for i := range tables {
+		tag := tagString(tables[i].tag)
+		switch tag {
+		case "glyf":
+			tables[i].data = glyf
+		case "loca":
+			tables[i].data = loca
+		case "hmtx":
+			tables[i].data = hmtx
+		default:
+			continue
+		}
+		tables[i].checksum = tableChecksum(tag, tables[i].data)
+	}
+	fx.ttf = buildSFNT(flavor, tables)
+	return fx
+}
+
+// encodeWOFF2 returns an SFNT font as a WOFF2 file. The glyf and loca tables
+// are transformed if transformGlyf and the hmtx table is transformed if
+// transformHmtx. Every other table has the null transform.
+func encodeWOFF2(t *testing.T, src []byte, transformGlyf bool, transformHmtx bool) []byte {
+	t.Helper()
+	flavor, tables := readTables(t, src)
+	m := tableMap(t, src)
+	// The loca table must follow the glyf table.
+	tags := []string(nil)
+	for _, table := range tables {
+		switch tag := tagString(table.tag); tag {
+		case "glyf":
+			tags = append(tags, "glyf", "loca")
+		case "loca":
+		default:
+			tags = append(tags, tag)
+		}
+	}
+
+	dst := make([]byte, 48)
+	copy(dst, "wOF2")
+	binary.BigEndian.PutUint32(dst[4:], flavor)
+	binary.BigEndian.PutUint16(dst[12:], uint16(len(tags)))
+	data := &bytes.Buffer{}
+	for _, tag := range tags {
+		flags := byte(0x3f)
+		for i, known := range woff2Tags {
+			if known == tag {
+				flags = byte(i)
+			}
+		}
+		transformed := []byte(nil)
+		switch {
+		case tag == "glyf" && transformGlyf:
+			indexFormat := binary.BigEndian.Uint16(m["head"][50:])
+			transformed = transformGlyfTable(t, splitGlyf(t, m["glyf"], m["loca"], indexFormat), indexFormat)
+		case tag == "loca" && transformGlyf:
+			transformed = []byte{}
+		case tag == "glyf" || tag == "loca":
+			flags |= 3 << 6
+		case tag == "hmtx" && transformHmtx:
+			indexFormat := binary.BigEndian.Uint16(m["head"][50:])
+			glyphs := splitGlyf(t, m["glyf"], m["loca"], indexFormat)
+			transformed = transformHmtxTable(t, m["hmtx"], int(binary.BigEndian.Uint16(m["hhea"][34:])), glyphs)
+			flags |= 1 << 6
+		}
+		dst = append(dst, flags)
+		if flags&0x3f == 0x3f {
+			dst = append(dst, tag...)
+		}
+		dst = appendBase128(dst, uint32(len(m[tag])))
+		if transformed != nil {
+			dst = appendBase128(dst, uint32(len(transformed)))
+			data.Write(transformed)
+		} else {
+			data.Write(m[tag])
+		}
+	}
+	compressed := &bytes.Buffer{}
+	w := brotli.NewWriter(compressed)
+	w.Write(data.Bytes())
+	w.Close()
+	binary.BigEndian.PutUint32(dst[20:], uint32(compressed.Len()))
+	dst = append(dst, compressed.Bytes()...)
+	binary.BigEndian.PutUint32(dst[8:], uint32(len(dst)))
+	return dst
+}
+
+func appendBase128(dst []byte, v uint32) []byte {
+	n := 1
+	for v>>(7*uint(n)) != 0 {
+		n++
+	}
+	for i := n - 1; i > 0; i-- {
+		dst = append(dst, 0x80|byte(v>>(7*uint(i))))
+	}
+	return append(dst, byte(v&0x7f))
+}
+
+func appendU255(dst []byte, v int) []byte {
+	switch {
+	case v < 253:
+		return append(dst, byte(v))
+	case v < 2*253:
+		return append(dst, 255, byte(v-253))
+	case v < 3*253:
+		return append(dst, 254, byte(v-2*253))
+	}
+	return appendUint16(append(dst, 253), uint16(v))
+}
+
+// transformGlyfTable returns the WOFF2 transformed glyf table of the glyphs.
+// Simple glyphs' bounding boxes are only written if they differ from their
+// points' bounds, except for glyph 0's, so that both cases are tested.
+func transformGlyfTable(t *testing.T, glyphs [][]byte, indexFormat uint16) []byte {
+	t.Helper()
+	numGlyphs := len(glyphs)
+	var nContourStream, nPointsStream, flagStream, glyphStream, compositeStream, bboxStream, instructionStream []byte
+	bboxBitmap := make([]byte, 4*((numGlyphs+31)/32))
+	overlapBitmap := make([]byte, (numGlyphs+7)/8)
+	hasOverlap := false
+
+	for i, g := range glyphs {
+		if len(g) == 0 {
+			nContourStream = appendUint16(nContourStream, 0)
+			continue
+		}
+		nContours := int(int16(binary.BigEndian.Uint16(g)))
+		nContourStream = append(nContourStream, g[0], g[1])
+		if nContours < 0 {
+			bboxBitmap[i>>3] |= 0x80 >> uint(i&7)
+			bboxStream = append(bboxStream, g[2:10]...)
+			p, hasInstructions := 10, false
+			for more := true; more; {
+				flags := binary.BigEndian.Uint16(g[p:])
+				n := 6
+				if flags&0x0001 != 0 {
+					n = 8
+				}
+				switch {
+				case flags&0x0008 != 0:
+					n += 2
+				case flags&0x0040 != 0:
+					n += 4
+				case flags&0x0080 != 0:
+					n += 8
+				}
+				compositeStream = append(compositeStream, g[p:p+n]...)
+				p += n
+				more = flags&0x0020 != 0
+				hasInstructions = hasInstructions || flags&0x0100 != 0
+			}
+			if hasInstructions {
+				n := int(binary.BigEndian.Uint16(g[p:]))
+				glyphStream = appendU255(glyphStream, n)
+				instructionStream = append(instructionStream, g[p+2:p+2+n]...)
+			}
+			continue
+		}
+
+		numPoints, p := 0, 10
+		for j := 0; j < nContours; j++ {
+			endPt := int(binary.BigEndian.Uint16(g[p:]))
+			nPointsStream = appendU255(nPointsStream, endPt+1-numPoints)
+			numPoints, p = endPt+1, p+2
+		}
+		instructionLength := int(binary.BigEndian.Uint16(g[p:]))
+		instructions := g[p+2 : p+2+instructionLength]
+		p += 2 + instructionLength
+
+		flags := make([]byte, 0, numPoints)
+		for len(flags) < numPoints {
+			f := g[p]
+			p++
+			flags = append(flags, f)
+			if f&0x08 != 0 {
+				for n := g[p]; n > 0; n-- {
+					flags = append(flags, f)
+				}
+				p++
+			}
+		}
+		coords := func(isShort byte, isSame byte) []int {
+			ret := make([]int, numPoints)
+			for j, f := range flags {
+				switch {
+				case f&isShort != 0 && f&isSame != 0:
+					ret[j] = int(g[p])
+					p++
+				case f&isShort != 0:
+					ret[j] = -int(g[p])
+					p++
+				case f&isSame == 0:
+					ret[j] = int(int16(binary.BigEndian.Uint16(g[p:])))
+					p += 2
+				}
+			}
+			return ret
+		}
+		dxs := coords(0x02, 0x10)
+		dys := coords(0x04, 0x20)
+
+		x, y := 0, 0
+		var b [4]int16
+		for j, f := range flags {
+			flagStream, glyphStream = appendTriplet(flagStream, glyphStream, f&0x01 != 0, dxs[j], dys[j])
+			x, y = x+dxs[j], y+dys[j]
+			if j == 0 {
+				b = [4]int16{int16(x), int16(y), int16(x), int16(y)}
+			}
+			b = [4]int16{min16(b[0], x), min16(b[1], y), max16(b[2], x), max16(b[3], y)}
+		}
+		glyphStream = appendU255(glyphStream, instructionLength)
+		instructionStream = append(instructionStream, instructions...)
+		if i == 0 || b != bbox(g) {
+			bboxBitmap[i>>3] |= 0x80 >> uint(i&7)
+			bboxStream = append(bboxStream, g[2:10]...)
+		}
+		if numPoints > 0 && flags[0]&0x40 != 0 {
+			overlapBitmap[i>>3] |= 0x80 >> uint(i&7)
+			hasOverlap = true
+		}
+	}
+
+	dst := appendUint16(nil, 0)
+	if hasOverlap {
+		dst = appendUint16(dst, 1)
+	} else {
+		dst = appendUint16(dst, 0)
+	}
+	dst = appendUint16(dst, uint16(numGlyphs))
+	dst = appendUint16(dst, indexFormat)
+	bboxStream = append(bboxBitmap, bboxStream...)
+	streams := [][]byte{nContourStream, nPointsStream, flagStream, glyphStream, compositeStream, bboxStream, instructionStream}
+	for _, s := range streams {
+		dst = appendUint32(dst, uint32(len(s)))
+	}
+	for _, s := range streams {
+		dst = append(dst, s...)
+	}
+	if hasOverlap {
+		dst = append(dst, overlapBitmap...)
+	}
+	return dst
+}
+
+func min16(a int16, b int) int16 {
+	if int(a) < b {
+		return a
+	}
+	return int16(b)
+}
+
+func max16(a int16, b int) int16 {
+	if int(a) > b {
+		return a
+	}
+	return int16(b)
+}
+
+// appendTriplet appends a point's flag, to the flag stream, and its
+// coordinate deltas, to the glyph stream, in the shortest WOFF2 triplet
+// encoding.
+func appendTriplet(flagStream []byte, glyphStream []byte, onCurve bool, dx int, dy int) ([]byte, []byte) {
+	flag := byte(0)
+	if !onCurve {
+		flag = 0x80
+	}
+	absX, absY, xySign := dx, dy, byte(3)
+	if dx < 0 {
+		absX, xySign = -dx, xySign&^1
+	}
+	if dy < 0 {
+		absY, xySign = -dy, xySign&^2
+	}
+	switch {
+	case dx == 0 && absY < 1280:
+		flag += byte((absY&0xf00)>>7) + xySign>>1
+		glyphStream = append(glyphStream, byte(absY))
+	case dy == 0 && absX < 1280:
+		flag += 10 + byte((absX&0xf00)>>7) + xySign&1
+		glyphStream = append(glyphStream, byte(absX))
+	case absX < 65 && absY < 65:
+		flag += 20 + byte((absX-1)&0x30) + byte(((absY-1)&0x30)>>2) + xySign
+		glyphStream = append(glyphStream, byte((absX-1)&0x0f)<<4|byte((absY-1)&0x0f))
+	case absX < 769 && absY < 769:
+		flag += 84 + 12*byte(((absX-1)&0x300)>>8) + byte(((absY-1)&0x300)>>6) + xySign
+		glyphStream = append(glyphStream, byte(absX-1), byte(absY-1))
+	case absX < 4096 && absY < 4096:
+		flag += 120 + xySign
+		glyphStream = append(glyphStream, byte(absX>>4), byte(absX<<4)|byte(absY>>8), byte(absY))
+	default:
+		flag += 124 + xySign
+		glyphStream = append(glyphStream, byte(absX>>8), byte(absX), byte(absY>>8), byte(absY))
+	}
+	return append(flagStream, flag), glyphStream
+}
+
+// transformHmtxTable returns the WOFF2 transformed hmtx table, omitting the
+// proportional or monospaced left side bearings if they all equal the glyphs'
+// xMins.
+func transformHmtxTable(t *testing.T, hmtx []byte, numHMetrics int, glyphs [][]byte) []byte {
+	t.Helper()
+	flags := byte(3)
+	lsbs := make([]uint16, len(glyphs))
+	for i, g := range glyphs {
+		if i < numHMetrics {
+			lsbs[i] = binary.BigEndian.Uint16(hmtx[4*i+2:])
+		} else {
+			lsbs[i] = binary.BigEndian.Uint16(hmtx[2*numHMetrics+2*i:])
+		}
+		if int16(lsbs[i]) == bbox(g)[0] {
+			continue
+		} else if i < numHMetrics {
+			flags &^= 1
+		} else {
+			flags &^= 2
+		}
+	}
+	if flags == 0 {
+		t.Fatal("the hmtx table has no left side bearings to omit")
+	}
+	dst := []byte{flags}
+	for i := 0; i < numHMetrics; i++ {
+		dst = append(dst, hmtx[4*i:4*i+2]...)
+	}
+	for i, lsb := range lsbs {
+		if (i < numHMetrics && flags&1 == 0) || (i >= numHMetrics && flags&2 == 0) {
+			dst = appendUint16(dst, lsb)
+		}
+	}
+	return dst
+}
+
+func TestDecodeWOFF2(t *testing.T) {
+	for _, tc := range goFonts {
+		got, err := decodeWOFF2(encodeWOFF2(t, tc.ttf, false, false), -1)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !bytes.Equal(got, rebuild(t, tc.ttf)) {
+			t.Errorf("%s: decoded WOFF2 differs from the original", tc.name)
+		}
+	}
+
+	woff2 := encodeWOFF2(t, goregular.TTF, false, false)
+	if _, err := decodeWOFF2(woff2, 0); err != errNotCollection {
+		t.Errorf("index 0: got %v, want %v", err, errNotCollection)
+	}
+	for _, n := range []int{0, 47, 100, len(woff2) / 2} {
+		if _, err := decodeWOFF2(woff2[:n], -1); err == nil {
+			t.Errorf("truncated to %d bytes: got nil error", n)
+		}
+	}
+}
+
+// loadGlyph returns a glyph's segments, in font units.
+func loadGlyph(t *testing.T, f *sfnt.Font, x sfnt.GlyphIndex) []sfnt.Segment {
+	t.Helper()
+	var buf sfnt.Buffer
+	segments, err := f.LoadGlyph(&buf, x, fixed.Int26_6(f.UnitsPerEm()), nil)
+	if err != nil {
+		t.Fatalf("glyph %d: %v", x, err)
+	}
+	return append([]sfnt.Segment(nil), segments...)
+}
+
+func TestWOFF2Fixture(t *testing.T) {
+	fx := newFixture(t)
+	if *updateFlag {
+		if err := ioutil.WriteFile(woff2Fixture, encodeWOFF2(t, fx.ttf, true, true), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src, err := ioutil.ReadFile(woff2Fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, encodeWOFF2(t, fx.ttf, true, true)) {
+		t.Fatalf("%s is out of date: run go test -update", woff2Fixture)
+	}
+
+	decoded, err := decodeWOFF2(src, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := sfnt.Parse(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := sfnt.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.NumGlyphs() != want.NumGlyphs() {
+		t.Fatalf("NumGlyphs: got %d, want %d", got.NumGlyphs(), want.NumGlyphs())
+	}
+
+	kept := map[sfnt.GlyphIndex]bool{}
+	for _, x := range fx.kept {
+		kept[x] = true
+	}
+	var gotBuf, wantBuf sfnt.Buffer
+	ppem := fixed.Int26_6(want.UnitsPerEm())
+	for i := 0; i < want.NumGlyphs(); i++ {
+		x := sfnt.GlyphIndex(i)
+		gotAdvance, err := got.GlyphAdvance(&gotBuf, x, ppem, font.HintingNone)
+		if err != nil {
+			t.Fatalf("glyph %d: %v", i, err)
+		}
+		wantAdvance, err := want.GlyphAdvance(&wantBuf, x, ppem, font.HintingNone)
+		if err != nil {
+			t.Fatalf("glyph %d: %v", i, err)
+		}
+		if gotAdvance != wantAdvance {
+			t.Errorf("glyph %d: advance: got %d, want %d", i, gotAdvance, wantAdvance)
+		}
+
+		segments := loadGlyph(t, got, x)
+		switch {
+		case kept[x]:
+			if w := loadGlyph(t, want, x); !reflect.DeepEqual(segments, w) {
+				t.Errorf("glyph %d: outline differs from Go Regular's", i)
+			}
+		case x == fx.composite:
+			w := loadGlyph(t, want, fx.base)
+			for _, s := range loadGlyph(t, want, fx.accent) {
+				for j := range s.Args {
+					s.Args[j].X += fixed.Int26_6(fixtureDX)
+					// The sfnt package's y axis points down.
+					s.Args[j].Y -= fixed.Int26_6(fixtureDY)
+				}
+				w = append(w, s)
+			}
+			if !reflect.DeepEqual(segments, w) {
+				t.Errorf("glyph %d: composite outline differs from Go Regular's components", i)
+			}
+		case len(segments) != 0:
+			t.Errorf("glyph %d: got %d segments, want none", i, len(segments))
+		}
+	}
+
+	// The left side bearings, all omitted from the fixture, are restored.
+	gotTables, wantTables := tableMap(t, decoded), tableMap(t, fx.ttf)
+	if !bytes.Equal(gotTables["hmtx"], wantTables["hmtx"]) {
+		t.Errorf("hmtx table differs")
+	}
+	numHMetrics := int(binary.BigEndian.Uint16(wantTables["hhea"][34:]))
+	glyphs := splitGlyf(t, wantTables["glyf"], wantTables["loca"], 0)
+	if flags := transformHmtxTable(t, wantTables["hmtx"], numHMetrics, glyphs)[0]; flags != 3 || numHMetrics == len(glyphs) {
+		t.Errorf("the fixture does not omit both proportional and monospaced left side bearings")
+	}
+
+	// The OVERLAP_SIMPLE flag is restored on the base glyph's first point.
+	g := splitGlyf(t, gotTables["glyf"], gotTables["loca"], 0)[fx.base]
+	nContours := int(binary.BigEndian.Uint16(g))
+	instructionLength := int(binary.BigEndian.Uint16(g[10+2*nContours:]))
+	if g[10+2*nContours+2+instructionLength]&0x40 == 0 {
+		t.Errorf("glyph %d: OVERLAP_SIMPLE flag is not set", fx.base)
+	}
+
+	if _, err := decodeWOFF2(src, 0); err != errNotCollection {
+		t.Errorf("index 0: got %v, want %v", err, errNotCollection)
+	}
+	for _, n := range []int{0, 47, 60, len(src) / 2, len(src) - 1} {
+		if _, err := decodeWOFF2(src[:n], -1); err == nil {
+			t.Errorf("truncated to %d bytes: got nil error", n)
+		}
+	}
+}
+
+func TestReconstructGlyfErrors(t *testing.T) {
+	fx := newFixture(t)
+	m := tableMap(t, fx.ttf)
+	glyphs := splitGlyf(t, m["glyf"], m["loca"], 0)
+	src := transformGlyfTable(t, glyphs, 0)
+	if _, _, _, err := reconstructGlyf(src); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{0, 35, 36, len(src) / 2, len(src) - 1} {
+		if _, _, _, err := reconstructGlyf(src[:n]); err == nil {
+			t.Errorf("truncated to %d bytes: got nil error", n)
+		}
+	}
+
+	empty := 0
+	for len(glyphs[empty]) != 0 {
+		empty++
+	}
+	bboxStream := 36
+	for i := 0; i < 5; i++ {
+		bboxStream += int(binary.BigEndian.Uint32(src[8+4*i:]))
+	}
+	testCases := []struct {
+		desc   string
+		mutate func(b []byte)
+	}{{
+		"glyph 1 has -2 contours",
+		func(b []byte) { binary.BigEndian.PutUint16(b[36+2*1:], 0xfffe) },
+	}, {
+		"the composite glyph has no bounding box",
+		func(b []byte) { b[bboxStream+int(fx.composite>>3)] &^= 0x80 >> uint(fx.composite&7) },
+	}, {
+		"an empty glyph has a bounding box",
+		func(b []byte) { b[bboxStream+empty>>3] |= 0x80 >> uint(empty&7) },
+	}, {
+		"the glyph stream is too long",
+		func(b []byte) { binary.BigEndian.PutUint32(b[8+4*3:], uint32(len(src))) },
+	}, {
+		"the instruction stream is one byte short",
+		func(b []byte) {
+			n := binary.BigEndian.Uint32(b[8+4*6:])
+			binary.BigEndian.PutUint32(b[8+4*6:], n-1)
+		},
+	}}
+	for _, tc := range testCases {
+		b := append([]byte(nil), src...)
+		tc.mutate(b)
+		if _, _, _, err := reconstructGlyf(b); err == nil {
+			t.Errorf("%s: got nil error", tc.desc)
+		}
+	}
+}
+
+func TestReconstructHmtxErrors(t *testing.T) {
+	fx := newFixture(t)
+	m := tableMap(t, fx.ttf)
+	glyphs := splitGlyf(t, m["glyf"], m["loca"], 0)
+	numHMetrics := int(binary.BigEndian.Uint16(m["hhea"][34:]))
+	src := transformHmtxTable(t, m["hmtx"], numHMetrics, glyphs)
+	_, _, xMins, err := reconstructGlyf(transformGlyfTable(t, glyphs, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reconstructHmtx(src, numHMetrics, xMins); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, m["hmtx"]) {
+		t.Fatal("hmtx table differs")
+	}
+
+	withFlags := func(flags byte) []byte {
+		return append([]byte{flags}, src[1:]...)
+	}
+	testCases := []struct {
+		desc        string
+		src         []byte
+		numHMetrics int
+	}{
+		{"no omitted left side bearings", withFlags(0), numHMetrics},
+		{"reserved flags", withFlags(0x07), numHMetrics},
+		{"truncated", src[:len(src)-1], numHMetrics},
+		{"no hMetrics", src, 0},
+		{"more hMetrics than glyphs", src, len(xMins) + 1},
+	}
+	for _, tc := range testCases {
+		if _, err := reconstructHmtx(tc.src, tc.numHMetrics, xMins); err == nil {
+			t.Errorf("%s: got nil error", tc.desc)
+		}
+	}
+
+	// The hmtx transform needs the glyf transform's xMins.
+	if _, err := decodeWOFF2(encodeWOFF2(t, fx.ttf, false, true), -1); err == nil {
+		t.Errorf("hmtx transformed without glyf: got nil error")
+	}
+}
+
+func TestTriplet(t *testing.T) {
+	testCases := []struct {
+		flag   byte
+		data   []byte
+		dx, dy int
+	}{
+		{0, []byte{5}, 0, -5},
+		{1, []byte{5}, 0, 5},
+		{3, []byte{5}, 0, 256 + 5},
+		{10, []byte{7}, -7, 0},
+		{11, []byte{7}, 7, 0},
+		{20, []byte{0x12}, -2, -3},
+		{23, []byte{0x12}, 2, 3},
+		{84, []byte{1, 2}, -2, -3},
+		{87, []byte{1, 2}, 2, 3},
+		{120, []byte{0x12, 0x34, 0x56}, -0x123, -0x456},
+		{123, []byte{0x12, 0x34, 0x56}, 0x123, 0x456},
+		{124, []byte{0x12, 0x34, 0x56, 0x78}, -0x1234, -0x5678},
+		{127, []byte{0x12, 0x34, 0x56, 0x78}, 0x1234, 0x5678},
+	}
+	for _, tc := range testCases {
+		s := woff2Stream{b: tc.data}
+		dx, dy := s.triplet(tc.flag)
+		if dx != tc.dx || dy != tc.dy || s.bad || len(s.b) != 0 {
+			t.Errorf("flag %d: got (%d, %d), bad %t, %d bytes left, want (%d, %d)",
+				tc.flag, dx, dy, s.bad, len(s.b), tc.dx, tc.dy)
+		}
+	}
+
+	// Every delta round-trips through the shortest encoding.
+	for _, d := range []int{0, 1, 64, 65, 255, 256, 768, 769, 1279, 1280, 4095, 4096, 32767} {
+		for _, delta := range [][2]int{{0, d}, {d, 0}, {d, d}, {-d, d}, {d, -d}, {-d, -d}, {d, 3}, {-3, d}} {
+			flags, data := appendTriplet(nil, nil, true, delta[0], delta[1])
+			s := woff2Stream{b: data}
+			dx, dy := s.triplet(flags[0])
+			if dx != delta[0] || dy != delta[1] || s.bad || len(s.b) != 0 {
+				t.Errorf("(%d, %d): flag %d: got (%d, %d), bad %t, %d bytes left",
+					delta[0], delta[1], flags[0], dx, dy, s.bad, len(s.b))
+			}
+		}
+	}
+}
@@ -1,9 +1,10 @@
 module github.com/nigeltao/fontscripts
 
-go 1.19
+go 1.22
 
 require (
+	github.com/andybalholm/brotli v1.2.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	golang.org/x/image v0.0.0-20220413100746-70e8d0d3baa9
-	golang.org/x/text v0.3.7
+	golang.org/x/text v0.14.0
 )